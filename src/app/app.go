@@ -5,6 +5,7 @@ import (
   "fmt"
   "github.com/m9rco/phoenix-shell/src/app/daemon"
   "github.com/m9rco/phoenix-shell/src/app/shell"
+  "github.com/m9rco/phoenix-shell/src/pkg/sandbox"
   "github.com/m9rco/phoenix-shell/src/pkg/util"
   "io"
   "log"
@@ -25,6 +26,10 @@ type flagSet struct {
 
   CodeInArg, CompileOnly, NoRc bool
 
+  User, Justify string
+
+  Lint string
+
   Web  bool
   Port int
 
@@ -50,8 +55,12 @@ func newFlagSet(stderr io.Writer) *flagSet {
   f.BoolVar(&f.JSON, "json", false, "show output in JSON. Useful with -buildinfo.")
 
   f.BoolVar(&f.CodeInArg, "c", false, "take first argument as code to execute")
-  f.BoolVar(&f.CompileOnly, "compileonly", false, "Parse/Compile but do not execute")
-  f.BoolVar(&f.NoRc, "norc", false, "run elvish without invoking rc.elv")
+  f.BoolVar(&f.CompileOnly, "compileonly", false, "check the command of -c against the policy without executing it, or show the policy")
+  f.BoolVar(&f.NoRc, "norc", false, "do not read /etc/lishrc and /etc/lish/$USER")
+  f.StringVar(&f.User, "user", "", "serve the named user instead of the current one (root only)")
+  f.StringVar(&f.Justify, "justify", "", "the justification of commands that require one, for use with -c")
+
+  f.StringVar(&f.Lint, "lint", "", "report problems in the given configuration file and quit")
 
   f.BoolVar(&f.Web, "web", false, "run backend of web interface")
   f.IntVar(&f.Port, "port", defaultWebPort, "the port of the web backend")
@@ -66,11 +75,18 @@ func newFlagSet(stderr io.Writer) *flagSet {
 }
 
 func Main(fds [3]*os.File, args []string) int {
+  if sandbox.IsHelper(args) {
+    return sandboxProgram{}.Main(fds, nil)
+  }
   flag := newFlagSet(fds[2])
   err := flag.Parse(args[1:])
   if err != nil {
     return 2
   }
+  if err := flag.checkFiles(setID()); err != nil {
+    fmt.Fprintln(fds[2], err)
+    return 2
+  }
   if flag.CPUProfile != "" {
     f, err := os.Create(flag.CPUProfile)
     if err != nil {
@@ -92,6 +108,29 @@ func Main(fds [3]*os.File, args []string) int {
   return FindProgram(flag).Main(fds, flag.Args())
 }
 
+// fileFlags name files that are opened with our privileges.
+var fileFlags = []string{"log", "logprefix", "cpuprofile", "lint", "bin", "db", "sock"}
+
+// checkFiles refuses the flags naming files when we run setuid or setgid, as
+// those files would be opened or created with privileges the caller does not
+// have.
+func (f *flagSet) checkFiles(setID bool) error {
+  if !setID {
+    return nil
+  }
+  for _, name := range fileFlags {
+    if fl := f.Lookup(name); fl != nil && fl.Value.String() != "" {
+      return fmt.Errorf("-%s is not allowed when running setuid or setgid", name)
+    }
+  }
+  return nil
+}
+
+// setID reports whether we run setuid or setgid.
+func setID() bool {
+  return os.Getuid() != os.Geteuid() || os.Getgid() != os.Getegid()
+}
+
 type Program interface {
   Main(fds [3]*os.File, args []string) int
 }
@@ -110,10 +149,16 @@ func FindProgram(flag *flagSet) Program {
       SockPath:      flag.Sock,
       LogPathPrefix: flag.LogPrefix,
     }}
+  case flag.Lint != "":
+    if len(flag.Args()) > 0 {
+      return badUsageProgram{"arguments are not allowed with -lint", flag}
+    }
+    return lintProgram{flag.Lint, flag.JSON}
   default:
     return &shell.Shell{
       BinPath: flag.Bin, SockPath: flag.Sock, DbPath: flag.DB,
       Cmd: flag.CodeInArg, CompileOnly: flag.CompileOnly,
-      NoRc: flag.NoRc, JSON: flag.JSON}
+      NoRc: flag.NoRc, JSON: flag.JSON, User: flag.User,
+      Justification: flag.Justify}
   }
 }
@@ -0,0 +1,33 @@
+package app
+
+import (
+  "io/ioutil"
+  "testing"
+)
+
+func TestCheckFiles(t *testing.T) {
+  for _, args := range [][]string{
+    {"-log", "/etc/passwd"},
+    {"-cpuprofile", "/etc/shadow"},
+    {"-logprefix", "/tmp/x"},
+    {"-lint", "/etc/shadow"},
+  } {
+    f := newFlagSet(ioutil.Discard)
+    if err := f.Parse(args); err != nil {
+      t.Fatal(err)
+    }
+    if err := f.checkFiles(true); err == nil {
+      t.Errorf("checkFiles(%q) when setuid => <nil>, want error", args)
+    }
+    if err := f.checkFiles(false); err != nil {
+      t.Errorf("checkFiles(%q) => %v, want <nil>", args, err)
+    }
+  }
+  f := newFlagSet(ioutil.Discard)
+  if err := f.Parse([]string{"-c", "ls"}); err != nil {
+    t.Fatal(err)
+  }
+  if err := f.checkFiles(true); err != nil {
+    t.Errorf("checkFiles(-c ls) when setuid => %v, want <nil>", err)
+  }
+}
@@ -0,0 +1,40 @@
+package app
+
+import (
+  "encoding/json"
+  "fmt"
+  "os"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/lint"
+)
+
+// lintProgram reports the problems found in a configuration file. It fails if
+// any of them is an error.
+type lintProgram struct {
+  path string
+  json bool
+}
+
+func (p lintProgram) Main(fds [3]*os.File, _ []string) int {
+  findings, err := lint.File(p.path)
+  if err != nil {
+    fmt.Fprintln(fds[2], err)
+    return 2
+  }
+  if p.json {
+    if findings == nil {
+      findings = []lint.Finding{}
+    }
+    json.NewEncoder(fds[1]).Encode(findings)
+  } else {
+    for i := range findings {
+      fmt.Fprintln(fds[1], &findings[i])
+    }
+  }
+  for _, f := range findings {
+    if f.Severity == lint.Error {
+      return 1
+    }
+  }
+  return 0
+}
@@ -0,0 +1,13 @@
+package app
+
+import (
+  "os"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/sandbox"
+)
+
+type sandboxProgram struct{}
+
+func (p sandboxProgram) Main(fds [3]*os.File, _ []string) int {
+  return sandbox.Init()
+}
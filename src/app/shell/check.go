@@ -0,0 +1,229 @@
+package shell
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "github.com/m9rco/phoenix-shell/src/pkg/config"
+  "github.com/m9rco/phoenix-shell/src/pkg/jail"
+  "github.com/m9rco/phoenix-shell/src/pkg/lexer"
+  "github.com/m9rco/phoenix-shell/src/pkg/policy"
+  "github.com/m9rco/phoenix-shell/src/pkg/sys"
+  "io"
+  "os"
+  "os/user"
+  "strings"
+)
+
+// verdict is the outcome of checking a command without running it, as
+// reported by -compileonly.
+type verdict struct {
+  Argv    []string `json:"argv"`
+  Allowed bool     `json:"allowed"`
+  Builtin bool     `json:"builtin,omitempty"`
+  Rule    string   `json:"rule,omitempty"`
+  Source  string   `json:"source,omitempty"`
+  Path    string   `json:"path,omitempty"`
+  Reason  string   `json:"reason,omitempty"`
+
+  // Expansion is the command line an alias stands for.
+  Expansion []string `json:"expansion,omitempty"`
+}
+
+// effectivePolicy describes where the policy of a user comes from, as
+// reported by -compileonly without a command.
+type effectivePolicy struct {
+  User   string       `json:"user"`
+  Groups []string     `json:"groups"`
+  Roles  []string     `json:"roles"`
+  Files  []string     `json:"files"`
+  Allow  []ruleSource `json:"allow"`
+  Deny   []ruleSource `json:"deny"`
+}
+
+type ruleSource struct {
+  Rule   string `json:"rule"`
+  Source string `json:"source"`
+}
+
+// showPolicy reports the effective policy of the user to out.
+func showPolicy(out io.Writer, cfg *config.Config, u *user.User, asJSON bool) int {
+  p := &effectivePolicy{
+    User: u.Username, Groups: userGroups(u), Roles: cfg.Roles, Files: cfg.Files,
+    Allow: sources(cfg.Policy.Rules), Deny: sources(cfg.Policy.Deny),
+  }
+  if asJSON {
+    json.NewEncoder(out).Encode(p)
+    return sys.EXIT_SUCCESS
+  }
+  fmt.Fprintf(out, "user: %s\n", p.User)
+  fmt.Fprintf(out, "groups: %s\n", strings.Join(p.Groups, " "))
+  fmt.Fprintf(out, "roles: %s\n", strings.Join(p.Roles, " "))
+  fmt.Fprintf(out, "files: %s\n", strings.Join(p.Files, " "))
+  for _, r := range p.Deny {
+    fmt.Fprintf(out, "deny: %s (%s)\n", r.Rule, r.Source)
+  }
+  for _, r := range p.Allow {
+    fmt.Fprintf(out, "allow: %s (%s)\n", r.Rule, r.Source)
+  }
+  return sys.EXIT_SUCCESS
+}
+
+func sources(rules []*policy.Rule) []ruleSource {
+  list := []ruleSource{}
+  for _, r := range rules {
+    list = append(list, ruleSource{r.String(), r.Source})
+  }
+  return list
+}
+
+// check decides whether the command may run in the working directory cwd.
+// It returns the matching rule and the resolved path of the program, or an
+// error saying why the command is forbidden; the rule and path are still
+// returned when they are known. A command expanded from an alias is only
+// allowed by the rule of the alias.
+func (s *session) check(cmds []string, cwd string, alias *policy.Alias) (*policy.Rule, string, error) {
+  // The working directory may have been reached through symbolic links,
+  // which the roots have been resolved from.
+  if _, err := s.roots.Check(cwd); err != nil {
+    return nil, "", errors.New("working directory " + policy.ErrOutsideRoots.Error())
+  }
+  var rule *policy.Rule
+  var path string
+  var err error
+  if alias != nil {
+    rule, path, err = s.policy().CheckAlias(alias, cmds)
+  } else {
+    rule, path, err = s.policy().Check(cmds)
+  }
+  if err != nil {
+    return rule, path, err
+  }
+  if err := rule.CheckPaths(cmds[1:], s.roots); err != nil {
+    return rule, path, err
+  }
+  return rule, path, nil
+}
+
+// expand returns the alias the command names and its expansion, or nil.
+func (s *session) expand(cmd []string) (*policy.Alias, []string, error) {
+  a := s.policy().Alias(cmd[0])
+  if a == nil {
+    return nil, nil, nil
+  }
+  argv, err := a.Expand(cmd[1:])
+  return a, argv, err
+}
+
+// checkOnly checks the commands of line against the policy of the user
+// without running anything, and reports the verdicts to out. The exit status
+// is that of a shell refusing the first forbidden command.
+func checkOnly(out io.Writer, cfg *config.Config, u *user.User, line string, asJSON bool) int {
+  s := &session{cfg: cfg, user: u}
+  // Commands are checked from where a session would start, inside of its
+  // jail if it has one. Entering that takes privileges, without which the
+  // verdicts are those outside of the jail.
+  if dir := cfg.ChrootDir(u.Username); dir != "" {
+    if err := jail.Enter(dir); err != nil {
+      fmt.Fprintf(os.Stderr, "phoenix-shell: chroot %s: %v; checking outside of the jail\n", dir, err)
+    } else {
+      cfg.Policy.Resolve()
+      if err := os.Chdir(u.HomeDir); err != nil {
+        logger.Println("staying in /:", err)
+      }
+    }
+  }
+  if err := s.confine(); err != nil {
+    fmt.Fprintln(os.Stderr, "phoenix-shell:", err)
+    return sys.EXIT_FAILURE
+  }
+  cmds, err := lexer.Split(line)
+  if err != nil {
+    report(out, &verdict{Reason: err.Error()}, asJSON)
+    return sys.EXIT_RESPON
+  }
+  retval := sys.EXIT_SUCCESS
+  for _, cmd := range cmds {
+    v := s.verdict(cmd)
+    if !v.Allowed && retval == sys.EXIT_SUCCESS {
+      retval = sys.FORBIDDEN
+    }
+    report(out, v, asJSON)
+  }
+  return retval
+}
+
+// verdict checks a single command like runOne does.
+func (s *session) verdict(cmd []string) *verdict {
+  v := &verdict{Argv: cmd}
+  if cmd[0] == "cd" {
+    v.Builtin = true
+    if len(cmd) > 2 {
+      v.Reason = "too many arguments"
+    } else if len(cmd) == 2 {
+      if _, err := s.roots.Check(s.expandHome(cmd[1])); err != nil {
+        v.Reason = err.Error()
+      }
+    }
+    v.Allowed = v.Reason == ""
+    return v
+  }
+  alias, argv, err := s.expand(cmd)
+  if err != nil {
+    v.Reason = err.Error()
+    return v
+  }
+  if alias != nil {
+    v.Expansion, cmd = argv, argv
+  }
+  cwd, err := os.Getwd()
+  if err != nil {
+    v.Reason = err.Error()
+    return v
+  }
+  rule, path, err := s.check(cmd, cwd, alias)
+  v.Path = path
+  if rule != nil {
+    v.Rule, v.Source = rule.String(), rule.Source
+  }
+  if err != nil {
+    v.Reason = err.Error()
+    return v
+  }
+  v.Allowed = true
+  return v
+}
+
+func report(out io.Writer, v *verdict, asJSON bool) {
+  if asJSON {
+    json.NewEncoder(out).Encode(v)
+    return
+  }
+  if v.Argv == nil {
+    fmt.Fprintf(out, "syntax error: %s\n", v.Reason)
+    return
+  }
+  status := "forbidden"
+  if v.Allowed {
+    status = "allowed"
+  }
+  fmt.Fprintf(out, "%s: %s\n", status, strings.Join(v.Argv, " "))
+  if v.Builtin {
+    fmt.Fprintln(out, "  builtin")
+  }
+  if v.Expansion != nil {
+    fmt.Fprintf(out, "  expansion: %s\n", strings.Join(v.Expansion, " "))
+  }
+  if v.Rule != "" {
+    fmt.Fprintf(out, "  rule: %s\n", v.Rule)
+  }
+  if v.Source != "" {
+    fmt.Fprintf(out, "  source: %s\n", v.Source)
+  }
+  if v.Path != "" {
+    fmt.Fprintf(out, "  path: %s\n", v.Path)
+  }
+  if v.Reason != "" {
+    fmt.Fprintf(out, "  reason: %s\n", v.Reason)
+  }
+}
@@ -0,0 +1,147 @@
+package shell
+
+import (
+  "bytes"
+  "encoding/json"
+  "github.com/m9rco/phoenix-shell/src/pkg/config"
+  "github.com/m9rco/phoenix-shell/src/pkg/sys"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "os/user"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestCheckOnly(t *testing.T) {
+  u, err := user.Current()
+  if err != nil {
+    t.Skip(err)
+  }
+  cfg := config.New()
+  if err := cfg.Parse(strings.NewReader("sh -c true\n"), "test"); err != nil {
+    t.Fatal(err)
+  }
+  var out bytes.Buffer
+  if status := checkOnly(&out, cfg, u, "sh -c true; sh -c false", true); status != sys.FORBIDDEN {
+    t.Errorf("checkOnly => %d, want %d", status, sys.FORBIDDEN)
+  }
+  dec := json.NewDecoder(&out)
+  var allowed, forbidden verdict
+  if err := dec.Decode(&allowed); err != nil || !allowed.Allowed || !strings.HasSuffix(allowed.Path, "/sh") || allowed.Rule == "" {
+    t.Errorf("first verdict => (%+v, %v), want allowed by a rule for sh", allowed, err)
+  }
+  if err := dec.Decode(&forbidden); err != nil || forbidden.Allowed || forbidden.Reason == "" {
+    t.Errorf("second verdict => (%+v, %v), want forbidden with a reason", forbidden, err)
+  }
+}
+
+func TestCheckOnlyAlias(t *testing.T) {
+  u, err := user.Current()
+  if err != nil {
+    t.Skip(err)
+  }
+  cfg := config.New()
+  rc := "sh -c *\n@alias run <what:true|false> = sh -c {what} @justify\n"
+  if err := cfg.Parse(strings.NewReader(rc), "test"); err != nil {
+    t.Fatal(err)
+  }
+  var out bytes.Buffer
+  if status := checkOnly(&out, cfg, u, "run true", true); status != sys.EXIT_SUCCESS {
+    t.Errorf("checkOnly => %d, want %d", status, sys.EXIT_SUCCESS)
+  }
+  var v verdict
+  if err := json.NewDecoder(&out).Decode(&v); err != nil || v.Source != "test:2" || !strings.Contains(v.Rule, "@justify") {
+    t.Errorf("verdict => (%+v, %v), want allowed by the rule of the alias", v, err)
+  }
+}
+
+func TestCheckSymlinkedCwd(t *testing.T) {
+  u, err := user.Current()
+  if err != nil {
+    t.Skip(err)
+  }
+  base, err := ioutil.TempDir("", "lish")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(base)
+  real, link := filepath.Join(base, "real"), filepath.Join(base, "link")
+  if err := os.Mkdir(real, 0755); err != nil {
+    t.Fatal(err)
+  }
+  if err := os.Symlink(real, link); err != nil {
+    t.Fatal(err)
+  }
+  wd, err := os.Getwd()
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.Chdir(wd)
+  defer os.Setenv("PWD", os.Getenv("PWD"))
+  // Getwd returns $PWD, as a shell sets it after "cd link".
+  if err := os.Chdir(link); err != nil {
+    t.Fatal(err)
+  }
+  os.Setenv("PWD", link)
+  if got, err := os.Getwd(); err != nil || got != link {
+    t.Skipf("Getwd => (%q, %v), want %q", got, err, link)
+  }
+
+  cfg := config.New()
+  if err := cfg.Parse(strings.NewReader("@dir "+base+"/real\nsh -c true\n"), "test"); err != nil {
+    t.Fatal(err)
+  }
+  var out bytes.Buffer
+  if status := checkOnly(&out, cfg, u, "sh -c true", false); status != sys.EXIT_SUCCESS {
+    t.Errorf("checkOnly => %d (%s), want %d", status, strings.TrimSpace(out.String()), sys.EXIT_SUCCESS)
+  }
+  if got, _ := os.Getwd(); got != link {
+    t.Errorf("working directory => %q, want %q kept", got, link)
+  }
+}
+
+func TestCheckOnlyJail(t *testing.T) {
+  if os.Geteuid() != 0 {
+    t.Skip("entering a jail takes root")
+  }
+  root, err := ioutil.TempDir("", "lish.jail")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(root)
+  if err := os.Mkdir(filepath.Join(root, "bin"), 0755); err != nil {
+    t.Fatal(err)
+  }
+  if err := ioutil.WriteFile(filepath.Join(root, "bin", "lish-jailed"), []byte("#!/bin/sh\n"), 0755); err != nil {
+    t.Fatal(err)
+  }
+  // The jail is entered for good, so by another process.
+  c := exec.Command(os.Args[0], "-test.run=^TestCheckOnlyJailHelper$")
+  c.Env = append(os.Environ(), "LISH_JAIL="+root)
+  out, err := c.Output()
+  if err != nil {
+    t.Fatalf("helper process => %v: %s", err, out)
+  }
+  var v verdict
+  if err := json.Unmarshal(out, &v); err != nil || !v.Allowed || v.Path != "/bin/lish-jailed" {
+    t.Errorf("verdict => (%+v, %v), want allowed with the path in the jail", v, err)
+  }
+}
+
+func TestCheckOnlyJailHelper(t *testing.T) {
+  root := os.Getenv("LISH_JAIL")
+  if root == "" {
+    return
+  }
+  u, err := user.Current()
+  if err != nil {
+    t.Fatal(err)
+  }
+  cfg := config.New()
+  if err := cfg.Parse(strings.NewReader("@chroot "+root+"\nlish-jailed\n"), "test"); err != nil {
+    t.Fatal(err)
+  }
+  os.Exit(checkOnly(os.Stdout, cfg, u, "lish-jailed", true))
+}
@@ -0,0 +1,49 @@
+package shell
+
+import (
+  "errors"
+  "fmt"
+  "github.com/m9rco/phoenix-shell/src/pkg/policy"
+  "strings"
+)
+
+// justificationVar may hold the justification of commands run without a
+// terminal, like the -justify flag.
+const justificationVar = "PHOENIX_SHELL_JUSTIFICATION"
+
+// errDeclined is returned by confirm if the user does not confirm or justify
+// a command.
+var errDeclined = errors.New("declined")
+
+// confirm asks the user to confirm the command, or to give a reason for it,
+// if its rule requires that, and returns the answer to be audited. Without a
+// terminal to ask on, the justification of the session is the answer; if
+// there is none, the command may not run.
+func (s *session) confirm(cmd []string, rule *policy.Rule) (string, error) {
+  if !rule.Confirm && !rule.Justify {
+    return "", nil
+  }
+  if s.ed == nil {
+    if s.justification == "" {
+      return "", fmt.Errorf("justification required, use -justify or set %s", justificationVar)
+    }
+    return s.justification, nil
+  }
+  line := strings.Join(cmd, " ")
+  if rule.Justify {
+    answer, err := s.ed.ReadLine(fmt.Sprintf("Reason for running %s: ", line))
+    if err != nil || answer == "" {
+      return "", errDeclined
+    }
+    return answer, nil
+  }
+  answer, err := s.ed.ReadLine(fmt.Sprintf("Run %s? [y/N] ", line))
+  if err != nil {
+    return "", errDeclined
+  }
+  switch strings.ToLower(answer) {
+  case "y", "yes":
+    return answer, nil
+  }
+  return "", errDeclined
+}
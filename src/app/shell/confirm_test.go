@@ -0,0 +1,51 @@
+package shell
+
+import (
+  "bufio"
+  "bytes"
+  "github.com/m9rco/phoenix-shell/src/pkg/policy"
+  "strings"
+  "testing"
+)
+
+func TestConfirm(t *testing.T) {
+  confirm := &policy.Rule{Confirm: true}
+  justify := &policy.Rule{Justify: true}
+  cmd := []string{"systemctl", "restart", "nginx"}
+  for _, c := range []struct {
+    rule   *policy.Rule
+    input  string
+    answer string
+    err    error
+  }{
+    {&policy.Rule{}, "", "", nil},
+    {confirm, "y\n", "y", nil},
+    {confirm, "YES\n", "YES", nil},
+    {confirm, "n\n", "", errDeclined},
+    {confirm, "", "", errDeclined},
+    {justify, "ticket 42\n", "ticket 42", nil},
+    {justify, "\n", "", errDeclined},
+    {justify, "ticket 43", "", errDeclined},
+  } {
+    var out bytes.Buffer
+    s := &session{ed: &minEditor{bufio.NewReader(strings.NewReader(c.input)), &out, true}}
+    answer, err := s.confirm(cmd, c.rule)
+    if answer != c.answer || err != c.err {
+      t.Errorf("confirm with %q => (%q, %v), want (%q, %v)", c.input, answer, err, c.answer, c.err)
+    }
+    if c.input != "" && !strings.Contains(out.String(), "systemctl restart nginx") {
+      t.Errorf("confirm with %q prompted %q, want the command", c.input, out.String())
+    }
+  }
+
+  s := &session{}
+  if _, err := s.confirm(cmd, justify); err == nil || err == errDeclined {
+    t.Errorf("confirm without terminal => %v, want justification required", err)
+  }
+  s.justification = "ticket 44"
+  for _, rule := range []*policy.Rule{confirm, justify} {
+    if answer, err := s.confirm(cmd, rule); answer != "ticket 44" || err != nil {
+      t.Errorf("confirm with justification => (%q, %v), want (%q, <nil>)", answer, err, "ticket 44")
+    }
+  }
+}
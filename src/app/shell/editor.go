@@ -3,6 +3,7 @@ package shell
 import (
   "bufio"
   "fmt"
+  "github.com/m9rco/phoenix-shell/src/pkg/sys"
   "io"
   "os"
   "strings"
@@ -10,26 +11,39 @@ import (
 
 type editor interface {
   ReadCode() (string, error)
+  // ReadLine reads a line of text other than code, such as an answer to a
+  // question, after showing the prompt.
+  ReadLine(prompt string) (string, error)
 }
 
 type minEditor struct {
   in  *bufio.Reader
   out io.Writer
+  // prompt is only shown when reading from a terminal.
+  prompt bool
 }
 
 func newMinEditor(in, out *os.File) *minEditor {
-  return &minEditor{bufio.NewReader(in), out}
+  return &minEditor{bufio.NewReader(in), out, sys.IsATTY(in)}
 }
 
 func (ed *minEditor) ReadCode() (string, error) {
-  wd, err := os.Getwd()
-  if err != nil {
-    wd = "?"
+  if ed.prompt {
+    wd, err := os.Getwd()
+    if err != nil {
+      wd = "?"
+    }
+    fmt.Fprintf(ed.out, "%s> ", wd)
   }
-  fmt.Fprintf(ed.out, "%s> ", wd)
   line, err := ed.in.ReadString('\n')
   line = strings.TrimSpace(line)
   line = strings.TrimRight(line, "\r\n\t")
   line = strings.TrimLeft(line, "\r\n\t")
   return line, err
 }
+
+func (ed *minEditor) ReadLine(prompt string) (string, error) {
+  fmt.Fprint(ed.out, prompt)
+  line, err := ed.in.ReadString('\n')
+  return strings.TrimSpace(line), err
+}
@@ -0,0 +1,47 @@
+package shell
+
+import (
+  "path/filepath"
+  "strings"
+)
+
+// secureEnv holds the variables that switch pagers into modes without shell
+// escapes.
+var secureEnv = []string{"LESSSECURE=1", "MORESECURE=1"}
+
+// unsafeEnv lists variables naming commands that pagers run.
+var unsafeEnv = []string{"LESSOPEN", "LESSCLOSE"}
+
+// viPrograms lists the programs of the vi family, which have a restricted
+// mode without shell commands enabled by -Z.
+var viPrograms = []string{"vi", "vim", "view", "vimdiff", "ex", "nvim"}
+
+// noEscape returns the arguments and environment of the program at path with
+// the mitigations of shell escapes of @noescape applied. Any shell the program
+// runs anyway is this one, given by shell.
+func noEscape(path string, argv, env []string, shell string) ([]string, []string) {
+  var safeEnv []string
+  for _, kv := range env {
+    name := kv[:strings.IndexByte(kv+"=", '=')]
+    if name == "SHELL" || contains(unsafeEnv, name) || isSecureVar(name) {
+      continue
+    }
+    safeEnv = append(safeEnv, kv)
+  }
+  safeEnv = append(safeEnv, secureEnv...)
+  safeEnv = append(safeEnv, "SHELL="+shell)
+
+  if contains(viPrograms, filepath.Base(path)) {
+    argv = append([]string{argv[0], "-Z"}, argv[1:]...)
+  }
+  return argv, safeEnv
+}
+
+func isSecureVar(name string) bool {
+  for _, kv := range secureEnv {
+    if strings.HasPrefix(kv, name+"=") {
+      return true
+    }
+  }
+  return false
+}
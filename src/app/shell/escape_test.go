@@ -0,0 +1,32 @@
+package shell
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestNoEscapeEnv(t *testing.T) {
+  env := []string{"PATH=/bin", "SHELL=/bin/bash", "LESSSECURE=0", "LESSOPEN=|sh %s", "TERM=xterm"}
+  _, env = noEscape("/usr/bin/less", []string{"less", "file"}, env, "/usr/bin/phoenix-shell")
+  want := "PATH=/bin TERM=xterm LESSSECURE=1 MORESECURE=1 SHELL=/usr/bin/phoenix-shell"
+  if got := strings.Join(env, " "); got != want {
+    t.Errorf("noEscape env => %q, want %q", got, want)
+  }
+}
+
+func TestNoEscapeVi(t *testing.T) {
+  for _, tt := range []struct {
+    path string
+    argv []string
+    want string
+  }{
+    {"/usr/bin/vim", []string{"vim", "file"}, "vim -Z file"},
+    {"/usr/bin/vi", []string{"vi"}, "vi -Z"},
+    {"/usr/bin/less", []string{"less", "file"}, "less file"},
+  } {
+    argv, _ := noEscape(tt.path, tt.argv, nil, "/usr/bin/phoenix-shell")
+    if got := strings.Join(argv, " "); got != tt.want {
+      t.Errorf("noEscape(%q, %q) => %q, want %q", tt.path, tt.argv, got, tt.want)
+    }
+  }
+}
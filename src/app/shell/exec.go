@@ -0,0 +1,171 @@
+package shell
+
+import (
+  "fmt"
+  "github.com/m9rco/phoenix-shell/src/pkg/cgroup"
+  "github.com/m9rco/phoenix-shell/src/pkg/limits"
+  "github.com/m9rco/phoenix-shell/src/pkg/policy"
+  "github.com/m9rco/phoenix-shell/src/pkg/sandbox"
+  "github.com/m9rco/phoenix-shell/src/pkg/sys"
+  "os"
+  "os/exec"
+  "os/signal"
+  "syscall"
+  "time"
+)
+
+type runner interface {
+  Start() error
+  Wait() error
+}
+
+// job is an allowed command prepared for execution.
+type job struct {
+  runner
+  cmd     *exec.Cmd
+  timeout time.Duration
+  // foreground is set if the command gets the terminal on stdin.
+  foreground bool
+  // cgroup is the cgroup of the command, if it has one.
+  cgroup *cgroup.Group
+}
+
+// errTimeout is returned by job.run if the command was killed because it ran
+// out of time.
+type errTimeout time.Duration
+
+func (e errTimeout) Error() string {
+  return fmt.Sprintf("killed after %v", time.Duration(e))
+}
+
+// command prepares the execution of a command allowed by rule, directly or,
+// if the configuration asks for anything to be set up in the new process,
+// through the sandbox helper.
+func (s *session) command(path string, argv []string, rule *policy.Rule) (*job, error) {
+  wd, err := os.Getwd()
+  if err != nil {
+    return nil, err
+  }
+  l := limits.Merge(s.cfg.Limits, rule.Limits)
+  profiles := append([]string{}, s.cfg.Seccomp...)
+  for _, name := range rule.Seccomp {
+    if !contains(profiles, name) {
+      profiles = append(profiles, name)
+    }
+  }
+  env := s.env
+  if rule.NoEscape {
+    argv, env = noEscape(path, argv, env, s.self)
+  }
+  spec := &sandbox.Spec{
+    Path:       path,
+    Argv:       argv,
+    Env:        env,
+    Dir:        wd,
+    Namespaces: s.cfg.Namespaces,
+    Binds:      s.roots,
+    Limits:     l,
+    Seccomp:    profiles,
+    NoNewPrivs: s.cfg.NoNewPrivs,
+  }
+  if s.cred != nil {
+    // Capabilities can only be granted while we have them to give.
+    spec.Credential, spec.Caps = s.cred, rule.Caps
+  }
+  j := &job{timeout: l.Timeout()}
+  if spec.NeedsHelper() || s.cfg.Cgroups.Command != nil {
+    c, err := sandbox.Command(s.self, spec)
+    if err != nil {
+      return nil, err
+    }
+    if s.cfg.Cgroups.Command != nil {
+      s.commands++
+      g, err := s.cgroup.Sub(fmt.Sprintf("command-%d", s.commands), s.cfg.Cgroups.Command)
+      if err != nil {
+        return nil, err
+      }
+      c.Prepare, j.cgroup = g.Add, g
+    }
+    j.runner, j.cmd = c, c.Cmd
+  } else {
+    c := exec.Command(path)
+    c.Args = argv
+    c.Env = env
+    j.runner, j.cmd = c, c
+  }
+  j.cmd.Stdin, j.cmd.Stdout, j.cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+  if j.timeout > 0 {
+    // The command gets a process group of its own, so that all of it can be
+    // killed when the time is up.
+    if j.cmd.SysProcAttr == nil {
+      j.cmd.SysProcAttr = &syscall.SysProcAttr{}
+    }
+    j.cmd.SysProcAttr.Setpgid = true
+    if s.tty != "" {
+      j.foreground = true
+      j.cmd.SysProcAttr.Foreground = true
+      j.cmd.SysProcAttr.Ctty = int(os.Stdin.Fd())
+    }
+  }
+  return j, nil
+}
+
+// run runs the command and waits for it to complete, killing its process
+// group once the timeout has passed.
+func (j *job) run() error {
+  if j.cgroup != nil {
+    defer j.removeCgroup()
+  }
+  if err := j.Start(); err != nil {
+    return err
+  }
+  if j.foreground {
+    defer takeTerminal(os.Stdin)
+  }
+  if j.timeout == 0 {
+    return j.Wait()
+  }
+  pgid := j.cmd.Process.Pid
+  timedOut := make(chan bool, 1)
+  timer := time.AfterFunc(j.timeout, func() {
+    timedOut <- true
+    _ = syscall.Kill(-pgid, syscall.SIGKILL)
+  })
+  err := j.Wait()
+  timer.Stop()
+  select {
+  case <-timedOut:
+    return errTimeout(j.timeout)
+  default:
+    return err
+  }
+}
+
+// removeCgroup removes the cgroup of the command, unless processes of it are
+// still running. They are killed at the end of the session.
+func (j *job) removeCgroup() {
+  if err := j.cgroup.Remove(); err != nil {
+    logger.Println(err)
+  }
+}
+
+// takeTerminal makes our process group the foreground process group of the
+// terminal again. SIGTTOU has to be ignored while doing so from the
+// background.
+func takeTerminal(tty *os.File) {
+  signal.Ignore(syscall.SIGTTOU)
+  defer signal.Reset(syscall.SIGTTOU)
+  if err := sys.Tcsetpgrp(int(tty.Fd()), syscall.Getpgrp()); err != nil {
+    logger.Println("unable to take back the terminal:", err)
+  }
+}
+
+func contains(list []string, s string) bool {
+  for _, x := range list {
+    if x == s {
+      return true
+    }
+  }
+  return false
+}
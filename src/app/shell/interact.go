@@ -2,34 +2,45 @@ package shell
 
 import (
   "fmt"
+  "github.com/m9rco/phoenix-shell/src/pkg/audit"
+  "github.com/m9rco/phoenix-shell/src/pkg/lexer"
+  "github.com/m9rco/phoenix-shell/src/pkg/policy"
   "github.com/m9rco/phoenix-shell/src/pkg/sys"
   "golang.org/x/sys/unix"
   "io"
   "os"
   "os/exec"
-  "os/user"
-  "strings"
   "syscall"
   "time"
 )
 
-func interact(fds [3]*os.File) {
+// interact reads commands from fds[0] until exit or end of input, and returns
+// the exit status of the last command.
+func interact(fds [3]*os.File, s *session) (retval int) {
   var ed editor
   ed = newMinEditor(fds[0], fds[2])
+  // Questions are only asked on a terminal, where someone can answer them.
+  terminal := sys.IsATTY(fds[0])
+  if terminal {
+    s.ed = ed
+  }
   sanitize(fds[0], fds[2])
   cooldown := time.Second
   for {
     line, err := ed.ReadCode()
-    if line == "" {
-      continue
-    }
     if err == io.EOF {
-      continue
+      if line != "" && line != "exit" {
+        retval = s.runCommand(line)
+      }
+      return
     } else if err != nil {
       fmt.Fprintln(fds[2], "Editor error:", err)
       if _, isMinEditor := ed.(*minEditor); !isMinEditor {
         fmt.Fprintln(fds[2], "Falling back to basic line editor")
         ed = newMinEditor(fds[0], fds[2])
+        if terminal {
+          s.ed = ed
+        }
       } else {
         fmt.Fprintln(fds[2], "Don't know what to do, pid is", os.Getpid())
         fmt.Fprintln(fds[2], "Restarting editor in", cooldown)
@@ -41,86 +52,146 @@ func interact(fds [3]*os.File) {
       continue
     }
     if line == "exit" {
-      break
+      return
     }
 
     if len(line) > 0 {
-      _ = runCommand(line)
+      retval = s.runCommand(line)
     }
     cooldown = time.Second
     sanitize(fds[0], fds[2])
   }
 }
 
-func switchDir(cmd []string) {
+// switchDir implements the cd builtin. The target directory is resolved
+// before it is checked against the allowed directories, so neither ".." nor
+// symbolic links lead out of them.
+func (s *session) switchDir(cmd []string) int {
   var dir string
   if len(cmd) > 2 {
-    fmt.Println("Too many arguments to builtin 'cd'.\n")
+    fmt.Fprintln(os.Stderr, "Too many arguments to builtin 'cd'.")
+    return sys.EXIT_FAILURE
   } else if len(cmd) == 2 {
-    dir = cmd[1]
+    dir = s.expandHome(cmd[1])
   } else {
-    u, err := user.Current()
-    if err != nil {
-      fmt.Println(fmt.Sprintf("Unable to get current user: %s\n", err))
-    }
-    dir = u.HomeDir
+    dir = s.user.HomeDir
   }
 
-  if dir == "~" {
-    u, err := user.Current()
-    if err != nil {
-      fmt.Println(fmt.Sprintf("Unable to get current user: %s\n", err))
-    }
-    dir = u.HomeDir
+  path, err := s.roots.Check(dir)
+  if err == policy.ErrOutsideRoots {
+    fmt.Fprintf(os.Stderr, "cd: %s: %v\n", dir, err)
+    return sys.FORBIDDEN
+  } else if err != nil {
+    fmt.Fprintf(os.Stderr, "cd: %v\n", err)
+    return sys.EXIT_FAILURE
   }
 
-  if _, err := os.Stat(dir); err != nil {
-    if os.IsNotExist(err) {
-      wd, err := os.Getwd()
-      if err != nil {
-        wd = "/"
-      }
-      dir = wd + dir
-      if _, err := os.Stat(dir); err != nil {
-        fmt.Println("Directory does not exist")
-        return
-      }
-    }
+  if err := os.Chdir(path); err != nil {
+    fmt.Fprintf(os.Stderr, "Unable to change directory to '%s': %s\n", dir, err)
+    return sys.EXIT_FAILURE
   }
+  return sys.EXIT_SUCCESS
+}
 
-  if err := os.Chdir(dir); err != nil {
-    fmt.Println(fmt.Sprintf("Unable to change directory to '%s': %s\n", dir, err))
+// runCommand runs the ';'-separated commands of a line in turn, checking each
+// of them against the policy on its own, and returns the exit status of the
+// last one. A forbidden command does not prevent the following ones from being
+// run.
+func (s *session) runCommand(line string) (retval int) {
+  retval = sys.EXIT_SUCCESS
+  cmds, err := lexer.Split(line)
+  if err != nil {
+    fmt.Fprintln(os.Stderr, "phoenix-shell:", err)
+    r := s.record(nil)
+    r.Line, r.Verdict, r.Reason, r.Status = line, audit.Rejected, err.Error(), sys.EXIT_RESPON
+    s.audit.Log(r)
+    return sys.EXIT_RESPON
+  }
+  for _, cmd := range cmds {
+    retval = s.runOne(cmd)
   }
   return
 }
 
-func runCommand(cmd string) (retval int) {
-  if len(cmd) <= 0 {
-    return
-  }
+func (s *session) runOne(cmds []string) (retval int) {
   retval = sys.EXIT_SUCCESS
-  _, err := os.Getwd()
+  r := s.record(cmds)
+  defer func() {
+    if r.Verdict == audit.Allowed {
+      // The session may have been closed in the meantime, which audited the
+      // completion already.
+      if s.finish(r) == nil {
+        return
+      }
+    } else if r.Verdict == "" {
+      // Only when panicking, see session.rescue.
+      r.Verdict = audit.Crashed
+    }
+    r.Status = retval
+    r.Duration = time.Since(r.Time).Seconds()
+    s.audit.Log(r)
+  }()
+
+  if cmds[0] == "cd" {
+    r.Verdict = audit.Builtin
+    return s.switchDir(cmds)
+  }
+  alias, argv, err := s.expand(cmds)
   if err != nil {
-    fmt.Fprintf(os.Stderr, "Unable to get current working directory: %v\n", err)
+    r.Verdict, r.Reason = audit.Forbidden, err.Error()
+    fmt.Fprintf(os.Stderr, "%s: %v\n", cmds[0], err)
+    return sys.FORBIDDEN
   }
-  cmds := strings.Fields(cmd)
-  given := strings.Join(cmds, " ")
-  if len(given) < 1 {
-    return
+  if alias != nil {
+    r.Alias, r.Argv = cmds, argv
+  } else {
+    argv = cmds
   }
-
-  if cmds[0] == "cd" {
-    switchDir(cmds)
-    return
+  rule, path, err := s.check(argv, r.Cwd, alias)
+  r.Path = path
+  if rule != nil {
+    r.Rule = rule.String()
   }
+  if err != nil {
+    r.Verdict, r.Reason = audit.Forbidden, err.Error()
+    fmt.Fprintf(os.Stderr, "%s: %v\n", cmds[0], err)
+    return sys.FORBIDDEN
+  }
+  if r.Justification, err = s.confirm(argv, rule); err != nil {
+    fmt.Fprintf(os.Stderr, "%s: %v\n", cmds[0], err)
+    r.Reason = err.Error()
+    if err == errDeclined {
+      r.Verdict = audit.Declined
+      return sys.EXIT_FAILURE
+    }
+    r.Verdict = audit.Forbidden
+    return sys.FORBIDDEN
+  }
+  // The command is audited before it runs, so that it is on record while it
+  // does, and even if the session ends before it.
+  s.start(r)
+  logger.Println("allowed", path, argv[1:])
 
-  c := exec.Command(cmds[0], cmds[1:]...)
-  c.Stdin = os.Stdin
-  c.Stdout = os.Stdout
-  c.Stderr = os.Stderr
-  if err := c.Run(); err != nil {
+  j, err := s.command(path, argv, rule)
+  if err == nil {
+    err = j.run()
+  }
+  if err != nil {
     if exitError, ok := err.(*exec.ExitError); ok {
-      retval = exitError.Sys().(syscall.WaitStatus).ExitStatus()
+      ws := exitError.Sys().(syscall.WaitStatus)
+      if ws.Signaled() {
+        retval = 128 + int(ws.Signal())
+      } else {
+        retval = ws.ExitStatus()
+      }
+    } else if _, ok := err.(errTimeout); ok {
+      r.Reason = err.Error()
+      fmt.Fprintf(os.Stderr, "%s: %v\n", cmds[0], err)
+      retval = 128 + int(syscall.SIGKILL)
+    } else {
+      r.Reason = err.Error()
+      fmt.Fprintf(os.Stderr, "%s: %v\n", cmds[0], err)
+      retval = sys.EXIT_FAILURE
     }
   }
 
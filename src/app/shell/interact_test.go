@@ -0,0 +1,65 @@
+package shell
+
+import (
+  "encoding/json"
+  "fmt"
+  "github.com/m9rco/phoenix-shell/src/pkg/audit"
+  "github.com/m9rco/phoenix-shell/src/pkg/config"
+  "io/ioutil"
+  "os"
+  "os/user"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestRunOneAudit(t *testing.T) {
+  u, err := user.Current()
+  if err != nil {
+    t.Skip(err)
+  }
+  dir, err := ioutil.TempDir("", "lish")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  file := filepath.Join(dir, "audit.json")
+  l, err := audit.Open([]string{file})
+  if err != nil {
+    t.Fatal(err)
+  }
+  cfg := config.New()
+  if err := cfg.Parse(strings.NewReader("sh -c *\n"), "test"); err != nil {
+    t.Fatal(err)
+  }
+  s := &session{cfg: cfg, user: u, audit: l, env: []string{"PATH=/bin:/usr/bin"}}
+
+  // The command only succeeds if it has been audited before it ran.
+  if status := s.runOne([]string{"sh", "-c", "grep -q allowed " + file + " && exit 3"}); status != 3 {
+    t.Errorf("runOne => %d, want 3", status)
+  }
+  s.start(s.record([]string{"sleep", "1"}))
+  s.close()
+
+  data, err := ioutil.ReadFile(file)
+  if err != nil {
+    t.Fatal(err)
+  }
+  var got []string
+  for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+    var r audit.Record
+    if err := json.Unmarshal([]byte(line), &r); err != nil {
+      t.Fatal(err)
+    }
+    got = append(got, fmt.Sprintf("%s %s %d %s", r.Argv[0], r.Verdict, r.Status, r.Reason))
+  }
+  want := []string{
+    "sh allowed 0 ",
+    "sh finished 3 ",
+    "sleep allowed 0 ",
+    "sleep finished 0 session closed while running",
+  }
+  if strings.Join(got, "\n") != strings.Join(want, "\n") {
+    t.Errorf("records => %q, want %q", got, want)
+  }
+}
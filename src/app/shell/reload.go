@@ -0,0 +1,113 @@
+package shell
+
+import (
+  "github.com/m9rco/phoenix-shell/src/pkg/audit"
+  "github.com/m9rco/phoenix-shell/src/pkg/config"
+  "github.com/m9rco/phoenix-shell/src/pkg/sys"
+  "github.com/m9rco/phoenix-shell/src/pkg/watch"
+  "sync"
+  "time"
+)
+
+// reloadDelay lets a file settle before it is read, as files are often
+// written in several steps.
+const reloadDelay = 200 * time.Millisecond
+
+// reloader replaces the policy of an interactive session when its files
+// change, or when asked to on SIGHUP. Only the rules are replaced; the other
+// settings apply to new sessions.
+type reloader struct {
+  s    *session
+  load func() (*config.Config, error)
+  // files are the files that may contribute to the policy, and read those
+  // read by the last successful load.
+  files []string
+  read  []string
+
+  // mu serializes reloads.
+  mu      sync.Mutex
+  watcher *watch.Watcher
+  timer   *time.Timer
+  stopped bool
+}
+
+// watchPolicy starts watching the files of the policy of the session, which
+// are read again by load.
+func (s *session) watchPolicy(load func() (*config.Config, error)) *reloader {
+  r := &reloader{
+    s: s, load: load,
+    files: config.Files(s.user.Username, userGroups(s.user)),
+    read:  s.cfg.Files,
+  }
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  r.watch()
+  s.reloader = r
+  return r
+}
+
+// watch replaces the watcher by one for the current files.
+func (r *reloader) watch() {
+  if r.watcher != nil {
+    r.watcher.Close()
+    r.watcher = nil
+  }
+  w, err := watch.New(append(append([]string{}, r.files...), r.read...), r.changed)
+  if err != nil {
+    logger.Println("not watching the policy:", err)
+    return
+  }
+  r.watcher = w
+}
+
+func (r *reloader) changed(path string) {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  if r.stopped {
+    return
+  }
+  if r.timer != nil {
+    r.timer.Stop()
+  }
+  r.timer = time.AfterFunc(reloadDelay, func() {
+    r.reload(path + " changed")
+  })
+}
+
+// reload loads the policy again and swaps it in, or keeps the current one if
+// that fails. Either way, the attempt is audited with the given reason.
+func (r *reloader) reload(reason string) {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  if r.stopped {
+    return
+  }
+  s := r.s
+  rec := s.record(nil)
+  cfg, err := r.load()
+  if err != nil {
+    rec.Verdict, rec.Reason, rec.Status = audit.ReloadFailed, reason+": "+err.Error(), sys.EXIT_FAILURE
+    logger.Println("keeping the policy:", err)
+  } else {
+    s.setPolicy(cfg.Policy)
+    rec.Verdict, rec.Reason = audit.Reloaded, reason
+    logger.Println("policy reloaded:", reason)
+    r.read = cfg.Files
+    r.watch()
+  }
+  s.audit.Log(rec)
+}
+
+// stop stops watching the files, and makes pending reloads do nothing.
+func (r *reloader) stop() {
+  r.mu.Lock()
+  defer r.mu.Unlock()
+  r.stopped = true
+  if r.timer != nil {
+    r.timer.Stop()
+  }
+  if r.watcher != nil {
+    r.watcher.Close()
+    r.watcher = nil
+  }
+}
@@ -0,0 +1,47 @@
+package shell
+
+import (
+  "errors"
+  "github.com/m9rco/phoenix-shell/src/pkg/config"
+  "github.com/m9rco/phoenix-shell/src/pkg/policy"
+  "os/user"
+  "strings"
+  "testing"
+)
+
+func TestReload(t *testing.T) {
+  u, err := user.Current()
+  if err != nil {
+    t.Skip(err)
+  }
+  s := &session{cfg: config.New(), user: u}
+  var next *config.Config
+  r := &reloader{s: s, load: func() (*config.Config, error) {
+    if next == nil {
+      return nil, errors.New("parse error")
+    }
+    return next, nil
+  }}
+
+  next = config.New()
+  if err := next.Parse(strings.NewReader("sh -c true\n"), "test"); err != nil {
+    t.Fatal(err)
+  }
+  r.reload("test")
+  if _, _, err := s.policy().Check([]string{"sh", "-c", "true"}); err != nil {
+    t.Errorf("Check after reload => %v, want <nil>", err)
+  }
+
+  next = nil
+  r.reload("test")
+  if _, _, err := s.policy().Check([]string{"sh", "-c", "true"}); err != nil {
+    t.Errorf("Check after failed reload => %v, want the old policy kept", err)
+  }
+
+  r.stop()
+  next = &config.Config{Policy: &policy.Policy{}}
+  r.reload("test")
+  if _, _, err := s.policy().Check([]string{"sh", "-c", "true"}); err != nil {
+    t.Errorf("Check after reload when stopped => %v, want the old policy kept", err)
+  }
+}
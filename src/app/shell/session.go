@@ -0,0 +1,480 @@
+package shell
+
+import (
+  "fmt"
+  "github.com/m9rco/phoenix-shell/src/pkg/audit"
+  "github.com/m9rco/phoenix-shell/src/pkg/cgroup"
+  "github.com/m9rco/phoenix-shell/src/pkg/config"
+  "github.com/m9rco/phoenix-shell/src/pkg/jail"
+  "github.com/m9rco/phoenix-shell/src/pkg/policy"
+  "github.com/m9rco/phoenix-shell/src/pkg/sandbox"
+  "github.com/m9rco/phoenix-shell/src/pkg/sys"
+  "os"
+  "os/user"
+  "path/filepath"
+  "runtime"
+  "strconv"
+  "strings"
+  "sync"
+  "syscall"
+  "time"
+)
+
+// session holds the state shared by all the commands run by a shell.
+type session struct {
+  // mu guards cfg.Policy, which may be replaced by a reloader at any time,
+  // and running.
+  mu   sync.Mutex
+  cfg  *config.Config
+  user *user.User
+  // self is the path of our own executable.
+  self string
+  // env is the complete environment of executed commands.
+  env []string
+  // cred is the identity of executed commands, or nil if they run as we do.
+  cred *sandbox.Credential
+
+  // roots are the directories the user is confined to.
+  roots policy.Roots
+
+  audit     *audit.Logger
+  tty       string
+  sshClient string
+  // running is the record of the command being run, whose completion is
+  // still to be audited, by runOne or by close if a signal ends the session
+  // first.
+  running *audit.Record
+
+  // cgroup is the cgroup of the session, if any, and home the one we were
+  // started in. commands counts the commands run, to name their cgroups.
+  cgroup   *cgroup.Group
+  home     *cgroup.Group
+  commands int
+
+  reloader *reloader
+
+  // ed asks the questions of @confirm and @justify, if the session is
+  // interactive on a terminal. Otherwise, justification answers them.
+  ed            editor
+  justification string
+}
+
+func newSession(cfg *config.Config, u *user.User, stdin *os.File) (*session, error) {
+  self, err := os.Executable()
+  if err != nil {
+    logger.Println("unable to find own executable:", err)
+    self = os.Args[0]
+  }
+  s := &session{cfg: cfg, user: u, self: self, env: environ(cfg, u, self)}
+  if s.cred, err = credential(u); err != nil {
+    return nil, err
+  }
+  // The audit targets are opened first, so that they may lie outside of the
+  // jail.
+  if cfg.Audit == nil {
+    // The default target is best effort, as not every system runs syslog.
+    l, err := audit.Open([]string{audit.Syslog})
+    if err != nil {
+      logger.Println("audit:", err)
+    }
+    s.audit = l
+  } else {
+    l, err := audit.Open(cfg.Audit)
+    if err != nil {
+      return nil, fmt.Errorf("audit: %v", err)
+    }
+    s.audit = l
+  }
+  if cfg.Cgroups.Enabled() {
+    if err := s.enterCgroup(); err != nil {
+      s.close()
+      return nil, fmt.Errorf("cgroup: %v", err)
+    }
+  }
+  if dir := cfg.ChrootDir(u.Username); dir != "" {
+    if err := s.enterJail(dir); err != nil {
+      s.close()
+      return nil, fmt.Errorf("chroot %s: %v", dir, err)
+    }
+  }
+  if err := s.confine(); err != nil {
+    s.close()
+    return nil, err
+  }
+  if sys.IsATTY(stdin) {
+    s.tty, _ = os.Readlink(fmt.Sprintf("/proc/self/fd/%d", stdin.Fd()))
+  }
+  s.sshClient = os.Getenv("SSH_CLIENT")
+  return s, nil
+}
+
+// enterJail makes dir the root directory after checking that every allowed
+// program can run inside of it, then drops the privileges needed to do so for
+// good, becoming the user, and changes to the user's home directory if it
+// exists in the jail.
+func (s *session) enterJail(dir string) error {
+  var programs []string
+  for _, r := range s.cfg.Policy.Rules {
+    programs = append(programs, r.Name)
+  }
+  if s.usesHelper() {
+    // Commands are run through our own executable.
+    programs = append(programs, s.self)
+  }
+  if err := jail.Check(dir, programs); err != nil {
+    return err
+  }
+  if err := jail.Enter(dir); err != nil {
+    return err
+  }
+  if cred := s.cred; cred != nil {
+    if s.cgroup != nil && cred.Uid != 0 {
+      // Cgroups of commands are still created once privileges are dropped.
+      if err := s.cgroup.Delegate(int(cred.Uid), int(cred.Gid)); err != nil {
+        return err
+      }
+    }
+    if os.Geteuid() == 0 {
+      // Commands run directly from now on, and must not regain what we
+      // give up. The bounding set belongs to a thread, and commands are
+      // started from this goroutine, so it keeps the thread for good.
+      runtime.LockOSThread()
+      if err := sandbox.DropBoundingSet(); err != nil {
+        return fmt.Errorf("dropping privileges: %v", err)
+      }
+    }
+    var groups []int
+    if cred.Groups != nil {
+      groups = make([]int, len(cred.Groups))
+      for i, g := range cred.Groups {
+        groups[i] = int(g)
+      }
+    }
+    if err := sys.SwitchUser(int(cred.Uid), int(cred.Gid), groups); err != nil {
+      return fmt.Errorf("dropping privileges: %v", err)
+    }
+    // Commands now simply run as we do.
+    s.cred = nil
+  }
+  if missing := s.cfg.Policy.Resolve(); len(missing) > 0 {
+    return fmt.Errorf("not found in the jail: %s", strings.Join(missing, " "))
+  }
+  if err := os.Chdir(s.user.HomeDir); err != nil {
+    logger.Println("staying in /:", err)
+  }
+  return nil
+}
+
+// credential returns the identity commands run as when ours differs from the
+// user's, because we are setuid or setgid or were started by root to serve
+// the user: the user's, with the groups of the user database. Only root may
+// change the supplementary groups, so they are otherwise kept. It returns nil
+// if commands may run as we do.
+func credential(u *user.User) (*sandbox.Credential, error) {
+  uid, err := strconv.ParseUint(u.Uid, 10, 32)
+  if err != nil {
+    return nil, fmt.Errorf("invalid uid %q", u.Uid)
+  }
+  gid, err := strconv.ParseUint(u.Gid, 10, 32)
+  if err != nil {
+    return nil, fmt.Errorf("invalid gid %q", u.Gid)
+  }
+  if int(uid) == os.Getuid() && int(uid) == os.Geteuid() && int(gid) == os.Getgid() && int(gid) == os.Getegid() {
+    return nil, nil
+  }
+  cred := &sandbox.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+  if os.Geteuid() == 0 {
+    ids, err := u.GroupIds()
+    if err != nil {
+      return nil, fmt.Errorf("groups of %s: %v", u.Username, err)
+    }
+    cred.Groups = []uint32{}
+    for _, id := range ids {
+      if g, err := strconv.ParseUint(id, 10, 32); err == nil {
+        cred.Groups = append(cred.Groups, uint32(g))
+      }
+    }
+  }
+  return cred, nil
+}
+
+// enterCgroup creates the cgroup of the session and moves us into it. We
+// occupy a leaf of our own, named "shell", as a cgroup with children cannot
+// contain processes.
+func (s *session) enterCgroup() error {
+  cfg := &s.cfg.Cgroups
+  current, err := cgroup.Current()
+  if err != nil {
+    return err
+  }
+  parentDir := cfg.Parent
+  if parentDir == "" {
+    mount, err := cgroup.Mount()
+    if err != nil {
+      return err
+    }
+    parentDir = filepath.Join(mount, "phoenix-shell")
+  }
+  parent, err := cgroup.Open(parentDir)
+  if err != nil {
+    return err
+  }
+  defer parent.Close()
+  if err := parent.Enable(cgroup.Controllers(cfg.Session, cfg.Command)); err != nil {
+    return err
+  }
+  g, err := parent.Sub(fmt.Sprintf("%s-%d", s.user.Username, os.Getpid()), cfg.Session)
+  if err != nil {
+    return err
+  }
+  if err := g.Enable(cgroup.Controllers(cfg.Command)); err != nil {
+    g.Remove()
+    return err
+  }
+  shell, err := g.Sub("shell", nil)
+  if err != nil {
+    g.Remove()
+    return err
+  }
+  defer shell.Close()
+  home, err := cgroup.Open(current)
+  if err != nil {
+    g.Remove()
+    return err
+  }
+  if err := shell.Add(os.Getpid()); err != nil {
+    home.Close()
+    g.Remove()
+    return err
+  }
+  s.cgroup, s.home = g, home
+  return nil
+}
+
+// leaveCgroup kills every process left in the cgroup of the session and
+// removes it. We leave it first, so that they can all be killed at once,
+// see cgroup.Group.Kill. This may fail once privileges have been dropped, in
+// which case they are killed one by one and the empty cgroup is left behind.
+func (s *session) leaveCgroup() {
+  left := s.home.Add(os.Getpid())
+  if left != nil {
+    logger.Println("leaving cgroup of session:", left)
+  }
+  if err := s.cgroup.Kill(); err != nil {
+    logger.Println("killing processes of session:", err)
+  }
+  if left == nil {
+    if err := s.cgroup.Remove(); err != nil {
+      logger.Println(err)
+    }
+  }
+  s.home.Close()
+  s.cgroup = nil
+}
+
+// usesHelper reports whether any command may be run through the sandbox
+// helper.
+func (s *session) usesHelper() bool {
+  cfg := s.cfg
+  if len(cfg.Namespaces) > 0 || cfg.Limits.HasRlimits() || len(cfg.Seccomp) > 0 || cfg.Cgroups.Command != nil {
+    return true
+  }
+  if cfg.NoNewPrivs {
+    return true
+  }
+  for _, r := range cfg.Policy.Rules {
+    if r.Limits.HasRlimits() || len(r.Seccomp) > 0 {
+      return true
+    }
+  }
+  return false
+}
+
+// confine sets up the allowed directories of the user and, if the current
+// working directory lies outside of them, changes to the first one.
+func (s *session) confine() error {
+  var dirs []string
+  for _, dir := range s.cfg.Dirs {
+    dirs = append(dirs, s.expandHome(dir))
+  }
+  for _, group := range userGroups(s.user) {
+    for _, dir := range s.cfg.GroupDirs[group] {
+      dirs = append(dirs, s.expandHome(dir))
+    }
+  }
+  roots, err := policy.NewRoots(dirs)
+  if err != nil {
+    return fmt.Errorf("allowed directories: %v", err)
+  }
+  s.roots = roots
+  if len(roots) == 0 {
+    return nil
+  }
+  // Getwd returns $PWD, which may lead through symbolic links.
+  if wd, err := os.Getwd(); err == nil {
+    if _, err := roots.Check(wd); err == nil {
+      return nil
+    }
+  }
+  return os.Chdir(roots[0])
+}
+
+// expandHome replaces a leading "~" in path by the user's home directory.
+func (s *session) expandHome(path string) string {
+  if path == "~" || strings.HasPrefix(path, "~/") {
+    return s.user.HomeDir + path[1:]
+  }
+  return path
+}
+
+// userGroups returns the names of the groups the user is a member of.
+func userGroups(u *user.User) []string {
+  ids, err := u.GroupIds()
+  if err != nil {
+    logger.Println("unable to get groups:", err)
+    return nil
+  }
+  var names []string
+  for _, id := range ids {
+    if g, err := user.LookupGroupId(id); err == nil {
+      names = append(names, g.Name)
+    }
+  }
+  return names
+}
+
+// policy returns the current policy.
+func (s *session) policy() *policy.Policy {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  return s.cfg.Policy
+}
+
+// setPolicy replaces the policy.
+func (s *session) setPolicy(p *policy.Policy) {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.cfg.Policy = p
+}
+
+// close releases the resources held by the session and kills whatever is
+// left of its commands, if it has a cgroup.
+func (s *session) close() {
+  if s.reloader != nil {
+    s.reloader.stop()
+  }
+  if s.cgroup != nil {
+    s.leaveCgroup()
+  }
+  if r := s.finish(nil); r != nil {
+    r.Reason = "session closed while running"
+    r.Duration = time.Since(r.Time).Seconds()
+    s.audit.Log(r)
+  }
+  if err := s.audit.Close(); err != nil {
+    logger.Println("audit:", err)
+  }
+  s.audit = nil
+}
+
+// record starts an audit record for the given command.
+func (s *session) record(argv []string) *audit.Record {
+  cwd, err := os.Getwd()
+  if err != nil {
+    fmt.Fprintf(os.Stderr, "Unable to get current working directory: %v\n", err)
+  }
+  return &audit.Record{
+    Time:      time.Now(),
+    User:      s.user.Username,
+    TTY:       s.tty,
+    SSHClient: s.sshClient,
+    Cwd:       cwd,
+    Argv:      argv,
+  }
+}
+
+// start audits a command as allowed before it runs, and remembers its record
+// until finish is called.
+func (s *session) start(r *audit.Record) {
+  r.Verdict = audit.Allowed
+  s.audit.Log(r)
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  s.running = r
+}
+
+// finish forgets the record of the command being run, which must be r unless
+// r is nil, and returns it with the Finished verdict so that its completion
+// can be audited. It returns nil if that has been done already.
+func (s *session) finish(r *audit.Record) *audit.Record {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+  running := s.running
+  if running == nil || r != nil && running != r {
+    return nil
+  }
+  s.running = nil
+  running.Verdict = audit.Finished
+  return running
+}
+
+// environ builds the environment for executed commands from scratch. Nothing
+// is inherited from the caller but the variables explicitly passed through by
+// the configuration; PATH, USER and SHELL are always set by us.
+func environ(cfg *config.Config, u *user.User, shell string) []string {
+  env := []string{
+    "PATH=" + policy.DefaultPath,
+    "USER=" + u.Username,
+    "SHELL=" + shell,
+  }
+  for _, name := range cfg.Env {
+    if name == "PATH" || name == "USER" || name == "SHELL" {
+      continue
+    }
+    if value, ok := os.LookupEnv(name); ok {
+      env = append(env, name+"="+value)
+    }
+  }
+  return env
+}
+
+// maxRestarts bounds the number of times in a row the shell restarts itself
+// after an internal error, see rescue.
+const maxRestarts = 3
+
+// restartsVar counts the restarts in the environment of the shell.
+const restartsVar = "PHOENIX_SHELL_RESTARTS"
+
+// rescue recovers from a panic of the session. The stack is logged to the
+// audit targets, and the user only gets a generic error. With @rescue
+// restart, an interactive shell is replaced by a fresh instance of itself,
+// which is restricted like this one; otherwise, or if that fails, we exit
+// with a failure.
+func (s *session) rescue(stderr *os.File, retval *int, interactive bool) {
+  r := recover()
+  if r == nil {
+    return
+  }
+  rec := s.record(nil)
+  rec.Verdict, rec.Reason, rec.Stack = audit.Crashed, fmt.Sprint(r), sys.DumpStack()
+  rec.Status = sys.EXIT_FAILURE
+  s.audit.Log(rec)
+  logger.Printf("panic: %v\n%s", r, rec.Stack)
+  fmt.Fprintln(stderr, "phoenix-shell: internal error")
+  *retval = sys.EXIT_FAILURE
+
+  restarts, _ := strconv.Atoi(os.Getenv(restartsVar))
+  if s.cfg.Rescue != config.RescueRestart || !interactive || s.cfg.Chroot != "" || restarts >= maxRestarts {
+    return
+  }
+  s.close()
+  env := []string{fmt.Sprintf("%s=%d", restartsVar, restarts+1)}
+  for _, kv := range os.Environ() {
+    if !strings.HasPrefix(kv, restartsVar+"=") {
+      env = append(env, kv)
+    }
+  }
+  fmt.Fprintln(stderr, "phoenix-shell: restarting")
+  err := syscall.Exec(s.self, os.Args, env)
+  logger.Println("restart failed:", err)
+}
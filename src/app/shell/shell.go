@@ -1,11 +1,14 @@
 package shell
 
 import (
+  "errors"
+  "fmt"
+  "github.com/m9rco/phoenix-shell/src/pkg/config"
   "github.com/m9rco/phoenix-shell/src/pkg/sys"
   "github.com/m9rco/phoenix-shell/src/pkg/util"
   "os"
   "os/signal"
-  "syscall"
+  "os/user"
 )
 
 var logger = util.GetLogger("[shell] ")
@@ -18,37 +21,121 @@ type Shell struct {
   CompileOnly bool
   NoRc        bool
   JSON        bool
+  // User names the user to serve, if not the current one. Only root may
+  // serve another user; commands then run as that user.
+  User string
+  // Justification answers the questions of @confirm and @justify when there
+  // is no terminal to ask them on; it may also be given in the environment,
+  // see justificationVar.
+  Justification string
 }
 
-func (sh *Shell) Main(fds [3]*os.File, args []string) int {
-  defer rescue()
+func (sh *Shell) Main(fds [3]*os.File, args []string) (retval int) {
+  defer rescue(fds[2], &retval)
   //restoreTTY := term.SetupGlobal()
   //defer restoreTTY()
-  handleSignals(fds[2])
-  interact(fds)
-  return 0
+  u, err := sh.currentUser()
+  if err != nil {
+    fmt.Fprintln(fds[2], "phoenix-shell:", err)
+    return sys.EXIT_FAILURE
+  }
+  cfg, err := sh.loadConfig(u)
+  if err != nil {
+    fmt.Fprintln(fds[2], "phoenix-shell:", err)
+    return sys.EXIT_FAILURE
+  }
+  if sh.CompileOnly {
+    if !sh.Cmd {
+      return showPolicy(fds[1], cfg, u, sh.JSON)
+    }
+    if len(args) < 1 {
+      fmt.Fprintln(fds[2], "phoenix-shell: -c requires an argument")
+      return sys.EXIT_RESPON
+    }
+    return checkOnly(fds[1], cfg, u, args[0], sh.JSON)
+  }
+  s, err := newSession(cfg, u, fds[0])
+  if err != nil {
+    fmt.Fprintln(fds[2], "phoenix-shell:", err)
+    return sys.EXIT_FAILURE
+  }
+  defer s.close()
+  s.justification = sh.Justification
+  if s.justification == "" {
+    s.justification = os.Getenv(justificationVar)
+  }
+  code, forced := os.LookupEnv("SSH_ORIGINAL_COMMAND")
+  interactive := !forced && !sh.Cmd
+  defer s.rescue(fds[2], &retval, interactive)
+  var reload func()
+  if interactive && !sh.NoRc && cfg.Chroot == "" {
+    // In a jail, the files would be read from inside of it.
+    r := s.watchPolicy(func() (*config.Config, error) { return sh.loadConfig(u) })
+    reload = func() { r.reload("SIGHUP") }
+  }
+  handleSignals(fds[2], s.close, reload)
+
+  // Commands are taken from SSH_ORIGINAL_COMMAND, then from -c, and only then
+  // read interactively, so that a forced ssh command cannot be overridden.
+  if forced {
+    return s.runCommand(code)
+  }
+  if sh.Cmd {
+    if len(args) < 1 {
+      fmt.Fprintln(fds[2], "phoenix-shell: -c requires an argument")
+      return sys.EXIT_RESPON
+    }
+    return s.runCommand(args[0])
+  }
+  return interact(fds, s)
 }
 
-func rescue() {
-  if r := recover(); r != nil {
-    println(r)
-    print(sys.DumpStack())
-    currentShell := os.Getenv("SHELL")
-    if len(currentShell) <= 0 {
-      currentShell = "/bin/sh"
+// currentUser returns the user served by the shell.
+func (sh *Shell) currentUser() (*user.User, error) {
+  if sh.User == "" {
+    u, err := user.Current()
+    if err != nil {
+      return nil, fmt.Errorf("unable to get current user: %v", err)
     }
-    println("\nexecing recovery shell " + currentShell)
-    _ = syscall.Exec(currentShell, []string{currentShell}, os.Environ())
+    return u, nil
+  }
+  if os.Getuid() != 0 {
+    return nil, errors.New("-user requires root")
+  }
+  return user.Lookup(sh.User)
+}
+
+// loadConfig reads the configuration files of the user and the user's groups,
+// or returns an empty configuration if NoRc is set.
+func (sh *Shell) loadConfig(u *user.User) (*config.Config, error) {
+  if sh.NoRc {
+    return config.New(), nil
+  }
+  return config.Load(u.Username, userGroups(u))
+}
+
+// rescue recovers from a panic before a session has been set up. Whatever
+// happens, the user must never be left with an unrestricted shell, so the
+// details go to the debug log only and we exit with a failure.
+func rescue(stderr *os.File, retval *int) {
+  if r := recover(); r != nil {
+    logger.Printf("panic: %v\n%s", r, sys.DumpStack())
+    fmt.Fprintln(stderr, "phoenix-shell: internal error")
+    *retval = sys.EXIT_FAILURE
   }
 }
 
-func handleSignals(stderr *os.File) {
-  sigs := make(chan os.Signal)
+// handleSignals handles the signals we receive. The cleanup function is
+// called before exiting on a signal. If reload is not nil, it is called to
+// reload the policy on SIGHUP, unless that comes from a hangup of the
+// terminal.
+func handleSignals(stderr *os.File, cleanup, reload func()) {
+  sigs := make(chan os.Signal, 8)
   signal.Notify(sigs)
   go func() {
     for sig := range sigs {
       logger.Println("signal", sig)
-      handleSignal(sig, stderr)
+      handleSignal(sig, stderr, cleanup, reload)
     }
   }()
 }
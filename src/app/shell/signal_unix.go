@@ -9,10 +9,16 @@ import (
   "syscall"
 )
 
-func handleSignal(sig os.Signal, stderr *os.File) {
+func handleSignal(sig os.Signal, stderr *os.File, cleanup, reload func()) {
   switch sig {
   case syscall.SIGHUP:
+    // Once the terminal has hung up, it is no longer one.
+    if reload != nil && sys.IsATTY(os.Stdin) {
+      reload()
+      return
+    }
     _ = syscall.Kill(0, syscall.SIGHUP)
+    cleanup()
     os.Exit(0)
   case syscall.SIGUSR1:
     fmt.Fprint(stderr, sys.DumpStack())
@@ -0,0 +1,194 @@
+// Package audit records what restricted users attempt to do, to the local
+// syslog daemon and/or to files of JSON lines.
+package audit
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "log/syslog"
+  "os"
+  "path/filepath"
+  "strings"
+  "time"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/util"
+)
+
+// Syslog is the audit target that writes to the local syslog socket. Any
+// other target is the absolute path of a file that records are appended to.
+const Syslog = "syslog"
+
+// Verdicts of a Record.
+const (
+  Allowed   = "allowed"
+  Builtin   = "builtin"
+  Forbidden = "forbidden"
+  Rejected  = "rejected"
+  // Crashed records an internal error of the shell, with the stack in
+  // Record.Stack.
+  Crashed = "crashed"
+  // Reloaded and ReloadFailed record attempts to replace the policy of a
+  // session, with what caused them in Record.Reason.
+  Reloaded     = "reloaded"
+  ReloadFailed = "reload-failed"
+  // Declined records a command the user did not confirm or justify when
+  // asked to.
+  Declined = "declined"
+  // Finished records the exit status and run time of a command, whose
+  // Allowed record is written before it starts.
+  Finished = "finished"
+)
+
+var logger = util.GetLogger("[audit] ")
+
+// Record describes an attempt to run a command.
+type Record struct {
+  Time      time.Time `json:"time"`
+  User      string    `json:"user"`
+  TTY       string    `json:"tty,omitempty"`
+  SSHClient string    `json:"ssh_client,omitempty"`
+  Cwd       string    `json:"cwd,omitempty"`
+  // Line is the command line as typed, for lines that could not be split
+  // into commands. Alias is the command as typed if it was an alias, with
+  // its expansion in Argv.
+  Line    string   `json:"line,omitempty"`
+  Alias   []string `json:"alias,omitempty"`
+  Argv    []string `json:"argv,omitempty"`
+  Verdict string   `json:"verdict"`
+  Rule    string   `json:"rule,omitempty"`
+  Path    string   `json:"path,omitempty"`
+  Reason  string   `json:"reason,omitempty"`
+  // Justification is what the user gave when asked to confirm or justify
+  // the command.
+  Justification string `json:"justification,omitempty"`
+  Status        int    `json:"status"`
+  // Duration is the run time of the command in seconds.
+  Duration float64 `json:"duration"`
+  Stack    string  `json:"stack,omitempty"`
+}
+
+// String formats the record as space-separated key=value pairs, omitting
+// empty values.
+func (r *Record) String() string {
+  var b strings.Builder
+  add := func(key, value string) {
+    if value == "" {
+      return
+    }
+    if b.Len() > 0 {
+      b.WriteByte(' ')
+    }
+    fmt.Fprintf(&b, "%s=%q", key, value)
+  }
+  add("user", r.User)
+  add("tty", r.TTY)
+  add("ssh_client", r.SSHClient)
+  add("cwd", r.Cwd)
+  add("line", r.Line)
+  add("alias", strings.Join(r.Alias, " "))
+  add("argv", strings.Join(r.Argv, " "))
+  add("verdict", r.Verdict)
+  add("rule", r.Rule)
+  add("path", r.Path)
+  add("reason", r.Reason)
+  add("justification", r.Justification)
+  fmt.Fprintf(&b, " status=%d duration=%.3f", r.Status, r.Duration)
+  if r.Stack != "" {
+    fmt.Fprintf(&b, " stack=%q", r.Stack)
+  }
+  return b.String()
+}
+
+// Logger writes records to a set of targets. A nil *Logger discards all
+// records.
+type Logger struct {
+  syslog *syslog.Writer
+  files  []*os.File
+}
+
+// Open opens the given targets, each being either Syslog or an absolute file
+// path.
+func Open(targets []string) (*Logger, error) {
+  l := &Logger{}
+  for _, target := range targets {
+    if err := l.open(target); err != nil {
+      l.Close()
+      return nil, err
+    }
+  }
+  return l, nil
+}
+
+func (l *Logger) open(target string) error {
+  if target == Syslog {
+    if l.syslog != nil {
+      return nil
+    }
+    w, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_INFO, "phoenix-shell")
+    if err != nil {
+      return fmt.Errorf("unable to connect to syslog: %v", err)
+    }
+    l.syslog = w
+    return nil
+  }
+  if !filepath.IsAbs(target) {
+    return errors.New("audit file must be an absolute path: " + target)
+  }
+  f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+  if err != nil {
+    return err
+  }
+  l.files = append(l.files, f)
+  return nil
+}
+
+// Log writes a record to all targets. Failures are only reported to the debug
+// log, since there is nobody else to tell.
+func (l *Logger) Log(r *Record) {
+  if l == nil {
+    return
+  }
+  if l.syslog != nil {
+    var err error
+    if r.Verdict == Allowed || r.Verdict == Builtin || r.Verdict == Finished || r.Verdict == Reloaded {
+      err = l.syslog.Info(r.String())
+    } else {
+      err = l.syslog.Warning(r.String())
+    }
+    if err != nil {
+      logger.Println("failed to write to syslog:", err)
+    }
+  }
+  if len(l.files) == 0 {
+    return
+  }
+  line, err := json.Marshal(r)
+  if err != nil {
+    logger.Println("failed to marshal record:", err)
+    return
+  }
+  line = append(line, '\n')
+  for _, f := range l.files {
+    if _, err := f.Write(line); err != nil {
+      logger.Printf("failed to write to %s: %v", f.Name(), err)
+    }
+  }
+}
+
+// Close closes all targets.
+func (l *Logger) Close() error {
+  if l == nil {
+    return nil
+  }
+  var err error
+  if l.syslog != nil {
+    err = l.syslog.Close()
+  }
+  for _, f := range l.files {
+    if e := f.Close(); e != nil && err == nil {
+      err = e
+    }
+  }
+  return err
+}
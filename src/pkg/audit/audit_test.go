@@ -0,0 +1,64 @@
+package audit
+
+import (
+  "encoding/json"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "reflect"
+  "testing"
+  "time"
+)
+
+func TestLogFile(t *testing.T) {
+  dir, err := ioutil.TempDir("", "lish.audit")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  path := filepath.Join(dir, "audit.json")
+
+  l, err := Open([]string{path})
+  if err != nil {
+    t.Fatalf("Open => %v, want <nil>", err)
+  }
+  records := []*Record{
+    {Time: time.Unix(1, 0).UTC(), User: "alice", Argv: []string{"date", "+%Y"},
+      Verdict: Allowed, Rule: "/bin/date +%Y", Path: "/bin/date"},
+    {Time: time.Unix(2, 0).UTC(), User: "alice", Argv: []string{"sh"},
+      Verdict: Forbidden, Reason: "command not allowed", Status: 127},
+  }
+  for _, r := range records {
+    l.Log(r)
+  }
+  if err := l.Close(); err != nil {
+    t.Errorf("Close => %v, want <nil>", err)
+  }
+
+  f, err := os.Open(path)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer f.Close()
+  dec := json.NewDecoder(f)
+  for _, want := range records {
+    got := &Record{}
+    if err := dec.Decode(got); err != nil || !reflect.DeepEqual(got, want) {
+      t.Errorf("decoded (%v, %v), want (%v, <nil>)", got, err, want)
+    }
+  }
+}
+
+func TestOpenRelativePath(t *testing.T) {
+  if _, err := Open([]string{"audit.json"}); err == nil {
+    t.Error("Open with a relative path => <nil>, want error")
+  }
+}
+
+func TestNilLogger(t *testing.T) {
+  var l *Logger
+  l.Log(&Record{})
+  if err := l.Close(); err != nil {
+    t.Errorf("Close on nil Logger => %v, want <nil>", err)
+  }
+}
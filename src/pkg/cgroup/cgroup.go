@@ -0,0 +1,63 @@
+// Package cgroup places processes in cgroup v2 subtrees with limits on their
+// resources.
+package cgroup
+
+import (
+  "errors"
+  "fmt"
+  "regexp"
+  "sort"
+  "strings"
+)
+
+// Settings maps the names of the files of a cgroup to the values written to
+// them.
+type Settings map[string]string
+
+// patterns lists the settings that may be given, with the values they accept.
+var patterns = map[string]*regexp.Regexp{
+  "memory.max": regexp.MustCompile(`^([0-9]+[KMG]?|max)$`),
+  "cpu.max":    regexp.MustCompile(`^(max|[0-9]+)( [0-9]+)?$`),
+  "pids.max":   regexp.MustCompile(`^([0-9]+|max)$`),
+}
+
+// Set parses a setting of the form "name=value" into s. Since values cannot
+// contain spaces in the configuration, a comma separates the quota and the
+// period of cpu.max.
+func (s Settings) Set(setting string) error {
+  i := strings.IndexByte(setting, '=')
+  if i < 0 {
+    return fmt.Errorf("cgroup setting %q: missing value", setting)
+  }
+  name, value := setting[:i], strings.Replace(setting[i+1:], ",", " ", -1)
+  pattern, ok := patterns[name]
+  if !ok {
+    return fmt.Errorf("unknown cgroup setting %q", name)
+  }
+  if !pattern.MatchString(value) {
+    return fmt.Errorf("%s: invalid value %q", name, setting[i+1:])
+  }
+  s[name] = value
+  return nil
+}
+
+// Controllers returns the names of the controllers needed by the settings.
+func Controllers(settings ...Settings) []string {
+  seen := map[string]bool{}
+  var controllers []string
+  for _, s := range settings {
+    for name := range s {
+      controller := name[:strings.IndexByte(name, '.')]
+      if !seen[controller] {
+        seen[controller] = true
+        controllers = append(controllers, controller)
+      }
+    }
+  }
+  sort.Strings(controllers)
+  return controllers
+}
+
+// ErrBusy is returned by Group.Kill if processes are left after repeatedly
+// killing them.
+var ErrBusy = errors.New("processes left in cgroup")
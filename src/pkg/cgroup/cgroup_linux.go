@@ -0,0 +1,304 @@
+package cgroup
+
+import (
+  "bufio"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "syscall"
+  "time"
+
+  "golang.org/x/sys/unix"
+)
+
+// killRounds bounds the number of times the processes of a cgroup are killed,
+// or looked for, before Kill gives up, should they keep forking.
+const killRounds = 100
+
+// Group is a cgroup. It refers to its directory by an open file descriptor,
+// so that it stays usable after the root directory has changed.
+type Group struct {
+  path   string
+  dir    *os.File
+  parent *os.File
+  name   string
+}
+
+// Mount returns the mount point of the cgroup v2 hierarchy.
+func Mount() (string, error) {
+  f, err := os.Open("/proc/self/mountinfo")
+  if err != nil {
+    return "", err
+  }
+  defer f.Close()
+  scanner := bufio.NewScanner(f)
+  for scanner.Scan() {
+    // The file system type follows a separator after the optional fields.
+    fields := strings.Fields(scanner.Text())
+    for i := 6; i+1 < len(fields); i++ {
+      if fields[i] == "-" && fields[i+1] == "cgroup2" {
+        return fields[4], nil
+      }
+    }
+  }
+  if err := scanner.Err(); err != nil {
+    return "", err
+  }
+  return "", fmt.Errorf("no cgroup2 file system mounted")
+}
+
+// Current returns the path of the cgroup of the calling process.
+func Current() (string, error) {
+  mount, err := Mount()
+  if err != nil {
+    return "", err
+  }
+  data, err := ioutil.ReadFile("/proc/self/cgroup")
+  if err != nil {
+    return "", err
+  }
+  for _, line := range strings.Split(string(data), "\n") {
+    if strings.HasPrefix(line, "0::") {
+      return filepath.Join(mount, line[3:]), nil
+    }
+  }
+  return "", fmt.Errorf("not in a cgroup v2 hierarchy")
+}
+
+// Open opens the cgroup at path, creating it if needed.
+func Open(path string) (*Group, error) {
+  if err := os.MkdirAll(path, 0755); err != nil {
+    return nil, err
+  }
+  dir, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  return &Group{path: path, dir: dir}, nil
+}
+
+// Path returns the path of the cgroup, as it was when it was opened.
+func (g *Group) Path() string {
+  return g.path
+}
+
+// Enable enables the controllers for the children of the cgroup.
+func (g *Group) Enable(controllers []string) error {
+  if len(controllers) == 0 {
+    return nil
+  }
+  return g.write("cgroup.subtree_control", "+"+strings.Join(controllers, " +"))
+}
+
+// Sub creates a child cgroup with the given settings. The controllers they
+// need must have been enabled with Enable.
+func (g *Group) Sub(name string, settings Settings) (*Group, error) {
+  if err := unix.Mkdirat(int(g.dir.Fd()), name, 0755); err != nil {
+    return nil, fmt.Errorf("creating cgroup %s: %v", filepath.Join(g.path, name), err)
+  }
+  fd, err := unix.Openat(int(g.dir.Fd()), name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+  if err != nil {
+    unix.Unlinkat(int(g.dir.Fd()), name, unix.AT_REMOVEDIR)
+    return nil, err
+  }
+  // The child keeps a descriptor of its own for the parent, which may be
+  // closed before it.
+  parentFd, err := unix.FcntlInt(g.dir.Fd(), unix.F_DUPFD_CLOEXEC, 0)
+  if err != nil {
+    unix.Close(fd)
+    unix.Unlinkat(int(g.dir.Fd()), name, unix.AT_REMOVEDIR)
+    return nil, err
+  }
+  path := filepath.Join(g.path, name)
+  sub := &Group{
+    path:   path,
+    dir:    os.NewFile(uintptr(fd), path),
+    parent: os.NewFile(uintptr(parentFd), filepath.Dir(path)),
+    name:   name,
+  }
+  for file, value := range settings {
+    if err := sub.write(file, value); err != nil {
+      sub.Remove()
+      return nil, err
+    }
+  }
+  return sub, nil
+}
+
+// Add moves the process with the given pid into the cgroup.
+func (g *Group) Add(pid int) error {
+  return g.write("cgroup.procs", strconv.Itoa(pid))
+}
+
+// Delegate hands the cgroup over to a user, who may then create children and
+// move processes between them without further privileges. The limits of the
+// cgroup itself stay out of reach.
+func (g *Group) Delegate(uid, gid int) error {
+  for _, name := range []string{".", "cgroup.procs", "cgroup.threads", "cgroup.subtree_control"} {
+    if err := unix.Fchownat(int(g.dir.Fd()), name, uid, gid, 0); err != nil {
+      return fmt.Errorf("delegating cgroup %s: %v", g.path, err)
+    }
+  }
+  return nil
+}
+
+// Kill kills every process in the cgroup and its descendants, except the
+// calling one, and waits until they are gone. Unless the calling process is in
+// the cgroup, the kernel kills them all at once through cgroup.kill, which
+// Linux has since 5.14, or they are killed with the cgroup frozen, so that
+// none of them can fork in the meantime. It returns ErrBusy if some remain.
+func (g *Group) Kill() error {
+  self := os.Getpid()
+  pids, err := procs(g.dir)
+  if err != nil {
+    return err
+  }
+  inside := false
+  for _, pid := range pids {
+    inside = inside || pid == self
+  }
+  if !inside && g.write("cgroup.kill", "1") == nil {
+    return g.wait(self, false)
+  }
+  return g.killEach(self, !inside)
+}
+
+// killEach kills the processes of the cgroup but self one by one, with the
+// cgroup frozen first if freeze is set and the kernel supports that.
+func (g *Group) killEach(self int, freeze bool) error {
+  if freeze && g.write("cgroup.freeze", "1") == nil {
+    // Frozen processes still die of SIGKILL, but the cgroup must not stay
+    // frozen for whatever is added later.
+    defer g.write("cgroup.freeze", "0")
+  }
+  return g.wait(self, true)
+}
+
+// wait waits until no process but self is left in the cgroup, killing those
+// it finds if kill is set.
+func (g *Group) wait(self int, kill bool) error {
+  for round := 0; round < killRounds; round++ {
+    pids, err := procs(g.dir)
+    if err != nil {
+      return err
+    }
+    left := false
+    for _, pid := range pids {
+      if pid != self {
+        left = true
+        if kill {
+          syscall.Kill(pid, syscall.SIGKILL)
+        }
+      }
+    }
+    if !left {
+      return nil
+    }
+    time.Sleep(10 * time.Millisecond)
+  }
+  return ErrBusy
+}
+
+// Remove removes the cgroup with all its descendants, which must not contain
+// any processes, and closes it.
+func (g *Group) Remove() error {
+  err := removeChildren(g.dir)
+  if err == nil && g.parent != nil {
+    err = unix.Unlinkat(int(g.parent.Fd()), g.name, unix.AT_REMOVEDIR)
+  }
+  g.Close()
+  if err != nil {
+    return fmt.Errorf("removing cgroup %s: %v", g.path, err)
+  }
+  return nil
+}
+
+// Close releases the cgroup without removing it.
+func (g *Group) Close() error {
+  if g.parent != nil {
+    g.parent.Close()
+  }
+  return g.dir.Close()
+}
+
+func (g *Group) write(file, value string) error {
+  fd, err := unix.Openat(int(g.dir.Fd()), file, unix.O_WRONLY|unix.O_CLOEXEC, 0)
+  if err != nil {
+    return fmt.Errorf("%s: %v", filepath.Join(g.path, file), err)
+  }
+  defer unix.Close(fd)
+  if _, err := unix.Write(fd, []byte(value)); err != nil {
+    return fmt.Errorf("writing %q to %s: %v", value, filepath.Join(g.path, file), err)
+  }
+  return nil
+}
+
+// procs returns the processes in the cgroup open as dir and its descendants.
+func procs(dir *os.File) ([]int, error) {
+  var pids []int
+  err := walk(dir, func(fd int) error {
+    f := os.NewFile(uintptr(fd), "cgroup.procs")
+    defer f.Close()
+    data, err := ioutil.ReadAll(f)
+    if err != nil {
+      return err
+    }
+    for _, field := range strings.Fields(string(data)) {
+      if pid, err := strconv.Atoi(field); err == nil {
+        pids = append(pids, pid)
+      }
+    }
+    return nil
+  }, nil)
+  return pids, err
+}
+
+func removeChildren(dir *os.File) error {
+  return walk(dir, nil, func(parent int, name string) error {
+    return unix.Unlinkat(parent, name, unix.AT_REMOVEDIR)
+  })
+}
+
+// walk calls procsFunc, if not nil, with the open cgroup.procs file of dir
+// and of every descendant, and removeFunc, if not nil, for every descendant
+// after its own descendants.
+func walk(dir *os.File, procsFunc func(fd int) error, removeFunc func(parent int, name string) error) error {
+  if procsFunc != nil {
+    fd, err := unix.Openat(int(dir.Fd()), "cgroup.procs", unix.O_RDONLY|unix.O_CLOEXEC, 0)
+    if err != nil {
+      return err
+    }
+    if err := procsFunc(fd); err != nil {
+      return err
+    }
+  }
+  if _, err := dir.Seek(0, 0); err != nil {
+    return err
+  }
+  infos, err := dir.Readdir(-1)
+  if err != nil {
+    return err
+  }
+  for _, info := range infos {
+    if !info.IsDir() {
+      continue
+    }
+    fd, err := unix.Openat(int(dir.Fd()), info.Name(), unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+    if err != nil {
+      return err
+    }
+    child := os.NewFile(uintptr(fd), info.Name())
+    err = walk(child, procsFunc, removeFunc)
+    child.Close()
+    if err == nil && removeFunc != nil {
+      err = removeFunc(int(dir.Fd()), info.Name())
+    }
+    if err != nil {
+      return err
+    }
+  }
+  return nil
+}
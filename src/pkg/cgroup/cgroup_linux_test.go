@@ -0,0 +1,153 @@
+package cgroup
+
+import (
+  "bufio"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "syscall"
+  "testing"
+  "time"
+)
+
+// TestKill places a shell and the processes it forks in a cgroup below the
+// one of a session, and kills the session.
+func TestKill(t *testing.T) {
+  mount, err := Mount()
+  if err != nil {
+    t.Skip(err)
+  }
+  path := filepath.Join(mount, fmt.Sprintf("lish-test-%d", os.Getpid()))
+  root, err := Open(path)
+  if err != nil {
+    t.Skipf("no writable cgroup2 hierarchy: %v", err)
+  }
+  defer os.Remove(path)
+  defer root.Remove()
+  // Should the test fail, whatever is left must go before the cgroups.
+  defer root.Kill()
+  session, err := root.Sub("session", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  command, err := session.Sub("command", nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer command.Close()
+
+  // The shell forks once it has been moved into the cgroup.
+  c := exec.Command("/bin/sh", "-c", "read x; sleep 60 & sleep 60 & echo started; wait")
+  stdin, err := c.StdinPipe()
+  if err != nil {
+    t.Fatal(err)
+  }
+  stdout, err := c.StdoutPipe()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := c.Start(); err != nil {
+    t.Fatal(err)
+  }
+  defer c.Process.Kill()
+  if err := command.Add(c.Process.Pid); err != nil {
+    t.Fatal(err)
+  }
+  fmt.Fprintln(stdin, "go")
+  if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "started\n" {
+    t.Fatalf("shell printed (%q, %v), want started", line, err)
+  }
+  if pids, err := procs(session.dir); err != nil || len(pids) != 3 {
+    t.Fatalf("procs => (%v, %v), want the shell and its two children", pids, err)
+  }
+
+  if err := session.Delegate(65534, 65534); err != nil {
+    t.Errorf("Delegate => %v, want <nil>", err)
+  } else if info, err := os.Stat(filepath.Join(session.Path(), "cgroup.procs")); err != nil ||
+    info.Sys().(*syscall.Stat_t).Uid != 65534 {
+    t.Errorf("cgroup.procs after Delegate => (%v, %v), want owned by 65534", info, err)
+  }
+
+  if err := session.Kill(); err != nil {
+    t.Fatalf("Kill => %v, want <nil>", err)
+  }
+  if err := c.Wait(); err == nil {
+    t.Error("shell exited normally, want it killed")
+  }
+  if pids, err := procs(session.dir); err != nil || len(pids) != 0 {
+    t.Errorf("procs after Kill => (%v, %v), want none", pids, err)
+  }
+  sessionPath := session.Path()
+  if err := session.Remove(); err != nil {
+    t.Fatalf("Remove => %v, want <nil>", err)
+  }
+  if _, err := ioutil.ReadDir(sessionPath); !os.IsNotExist(err) {
+    t.Errorf("session cgroup after Remove => %v, want it gone", err)
+  }
+}
+
+// TestKillForkLoop kills a shell that keeps forking, once through
+// cgroup.kill and once one by one with the cgroup frozen.
+func TestKillForkLoop(t *testing.T) {
+  mount, err := Mount()
+  if err != nil {
+    t.Skip(err)
+  }
+  for _, tt := range []struct {
+    name string
+    kill func(g *Group) error
+  }{
+    {"Kill", (*Group).Kill},
+    {"killEach", func(g *Group) error { return g.killEach(os.Getpid(), true) }},
+  } {
+    path := filepath.Join(mount, fmt.Sprintf("lish-test-%d", os.Getpid()))
+    g, err := Open(path)
+    if err != nil {
+      t.Skipf("no writable cgroup2 hierarchy: %v", err)
+    }
+    if err := killForkLoop(g, tt.kill); err != nil {
+      t.Errorf("%s: %v", tt.name, err)
+    }
+    os.Remove(path)
+  }
+}
+
+func killForkLoop(g *Group, kill func(g *Group) error) error {
+  defer g.Remove()
+  defer g.killEach(os.Getpid(), false)
+
+  c := exec.Command("/bin/sh", "-c", "read x; echo started; while :; do sleep 60 & done")
+  stdin, err := c.StdinPipe()
+  if err != nil {
+    return err
+  }
+  stdout, err := c.StdoutPipe()
+  if err != nil {
+    return err
+  }
+  if err := c.Start(); err != nil {
+    return err
+  }
+  defer c.Process.Kill()
+  if err := g.Add(c.Process.Pid); err != nil {
+    return err
+  }
+  fmt.Fprintln(stdin, "go")
+  if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "started\n" {
+    return fmt.Errorf("shell printed (%q, %v), want started", line, err)
+  }
+  time.Sleep(50 * time.Millisecond)
+
+  if err := kill(g); err != nil {
+    return fmt.Errorf("kill => %v, want <nil>", err)
+  }
+  if pids, err := procs(g.dir); err != nil || len(pids) != 0 {
+    return fmt.Errorf("procs after kill => (%v, %v), want none", pids, err)
+  }
+  if data, err := ioutil.ReadFile(filepath.Join(g.Path(), "cgroup.freeze")); err == nil && string(data) != "0\n" {
+    return fmt.Errorf("cgroup.freeze after kill => %q, want 0", data)
+  }
+  return nil
+}
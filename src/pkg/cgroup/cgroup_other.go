@@ -0,0 +1,31 @@
+//go:build !linux
+// +build !linux
+
+package cgroup
+
+import (
+  "errors"
+)
+
+var errUnsupported = errors.New("cgroups are not supported on this platform")
+
+// Group is a cgroup. Cgroups are only supported on Linux.
+type Group struct{}
+
+// Mount returns the mount point of the cgroup v2 hierarchy.
+func Mount() (string, error) { return "", errUnsupported }
+
+// Current returns the path of the cgroup of the calling process.
+func Current() (string, error) { return "", errUnsupported }
+
+// Open opens the cgroup at path, creating it if needed.
+func Open(path string) (*Group, error) { return nil, errUnsupported }
+
+func (g *Group) Path() string                                       { return "" }
+func (g *Group) Enable(controllers []string) error                  { return errUnsupported }
+func (g *Group) Sub(name string, settings Settings) (*Group, error) { return nil, errUnsupported }
+func (g *Group) Add(pid int) error                                  { return errUnsupported }
+func (g *Group) Delegate(uid, gid int) error                        { return errUnsupported }
+func (g *Group) Kill() error                                        { return errUnsupported }
+func (g *Group) Remove() error                                      { return errUnsupported }
+func (g *Group) Close() error                                       { return errUnsupported }
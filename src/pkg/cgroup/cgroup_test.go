@@ -0,0 +1,30 @@
+package cgroup
+
+import (
+  "strings"
+  "testing"
+)
+
+func TestSet(t *testing.T) {
+  s := Settings{}
+  for _, setting := range []string{"memory.max=512M", "cpu.max=50000,100000", "pids.max=max"} {
+    if err := s.Set(setting); err != nil {
+      t.Errorf("Set(%q) => %v, want <nil>", setting, err)
+    }
+  }
+  if v := s["cpu.max"]; v != "50000 100000" {
+    t.Errorf("cpu.max => %q, want %q", v, "50000 100000")
+  }
+  for _, setting := range []string{"memory.max", "memory.high=1G", "memory.max=1X", "cpu.max=50000,", "pids.max=-1"} {
+    if err := s.Set(setting); err == nil {
+      t.Errorf("Set(%q) => <nil>, want error", setting)
+    }
+  }
+}
+
+func TestControllers(t *testing.T) {
+  c := Controllers(Settings{"pids.max": "10", "memory.max": "1G"}, Settings{"pids.max": "5", "cpu.max": "max"})
+  if s := strings.Join(c, " "); s != "cpu memory pids" {
+    t.Errorf("Controllers => %q, want %q", s, "cpu memory pids")
+  }
+}
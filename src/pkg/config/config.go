@@ -0,0 +1,591 @@
+// Package config reads the configuration files that define what a restricted
+// user may do.
+//
+// The syntax is intentionally simplistic: files are processed one line at a
+// time, anything including and following a '#' is ignored, leading and
+// trailing whitespace is ignored, and each remaining line names a single
+// program with optional command-line flags. See policy.ParseRule for how a
+// line is turned into a rule. Rules with a program prefixed by '!' deny what
+// they match, whatever other rules allow. They match the program with any
+// arguments among which each of theirs is found, in any position: "!git
+// push --force" denies "git push origin --force", and "!bash" denies bash
+// altogether.
+//
+// Arguments of rules match just themselves, except for a trailing "*", which
+// allows any further arguments. With the @patterns rule option, they are
+// globs such as "*.service" or, when starting with "~", regular expressions;
+// see policy.ParseRule. Rules written for a version of phoenix-shell that
+// always treated arguments as patterns need @patterns added, and lint warns
+// about arguments that look like globs in rules without it. Arguments such
+// as "~/notes" keep matching just themselves without it.
+//
+// The files of a user are read in the order GlobalFile, the files of the
+// user's groups in GroupDir, the files of the user's roles in RoleDir and
+// the file of the user in UserDir; see Load.
+//
+// Lines starting with '@' are directives instead of rules:
+//
+//	@include FILE...
+//	                read the given files at this point; relative paths are
+//	                relative to the directory of the including file
+//	@role NAME...   give the user the named roles, whose files are read
+//	                before the user's file; role files may give further
+//	                roles
+//	@env NAME...    pass the named variables of the caller's environment
+//	                through to executed commands
+//	@audit TARGET...
+//	                write audit records to "syslog" and/or to the given
+//	                absolute file paths, or nowhere with "none"; the
+//	                default is syslog
+//	@dir DIR...     confine the user to the given directories; "~" stands
+//	                for the user's home directory
+//	@groupdir GROUP DIR...
+//	                like @dir, for members of the given group only
+//	@namespace NAME...
+//	                run commands in new namespaces of the given kinds:
+//	                mount, pid, ipc, uts and net; with a mount namespace
+//	                the file system is restricted to the allowed directories,
+//	                and a pid namespace always gets a /proc of its own
+//	@limit NAME=VALUE...
+//	                resource limits of every command, see limits.Names;
+//	                rules may override them with @limit
+//	@seccomp PROFILE...
+//	                install the named seccomp profiles for every command:
+//	                no-network or read-only, see seccomp.Profiles; rules
+//	                may add more with @seccomp
+//	@cgroup session|command SETTING...
+//	                place the session, or additionally every command, in a
+//	                cgroup of its own with the given settings: memory.max,
+//	                cpu.max (with a comma between quota and period) and
+//	                pids.max; the processes left in the cgroup of the
+//	                session are killed when it ends
+//	@cgroup parent DIR
+//	                create the cgroups below DIR instead of below
+//	                phoenix-shell in the cgroup v2 hierarchy
+//	@rescue exit|restart
+//	                what to do after an internal error, which is logged to
+//	                the audit targets: exit with a failure, the default, or
+//	                restart an interactive shell, unless in a chroot jail
+//	@chroot DIR     run the whole session with DIR as the root directory;
+//	                "%u" stands for the user name. Programs, allowed
+//	                directories and the home directory are looked up inside
+//	                the jail
+//	@nonewprivs     keep commands from gaining privileges through setuid
+//	                programs or file capabilities
+//	@alias NAME [<PARAM:TYPE>...] = PROGRAM [ARG...] [@OPTION...]
+//	                let the user run NAME with the given parameters, which
+//	                is replaced by the command line after "=" with the
+//	                values in place of "{PARAM}"; the command is allowed
+//	                for these values only, see policy.ParseAlias. TYPE is
+//	                int, duration (such as 90m or 1d), date (YYYY-MM-DD),
+//	                word, or choices such as nginx|apache
+package config
+
+import (
+  "bufio"
+  "errors"
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/audit"
+  "github.com/m9rco/phoenix-shell/src/pkg/cgroup"
+  "github.com/m9rco/phoenix-shell/src/pkg/limits"
+  "github.com/m9rco/phoenix-shell/src/pkg/policy"
+  "github.com/m9rco/phoenix-shell/src/pkg/sandbox"
+  "github.com/m9rco/phoenix-shell/src/pkg/seccomp"
+  "github.com/m9rco/phoenix-shell/src/pkg/util"
+)
+
+const (
+  // GlobalFile is read first and applies to every user.
+  GlobalFile = "/etc/lishrc"
+  // UserDir contains optional per-user files named after the user.
+  UserDir = "/etc/lish"
+  // GroupDir contains optional files named after groups, which apply to
+  // their members.
+  GroupDir = "/etc/lish/group.d"
+  // RoleDir contains the files of the roles given by @role.
+  RoleDir = "/etc/lish/role.d"
+)
+
+// maxIncludeDepth bounds the nesting of @include.
+const maxIncludeDepth = 8
+
+var logger = util.GetLogger("[config] ")
+
+// Config is the effective configuration of a session.
+type Config struct {
+  Policy *policy.Policy
+  // Env lists the variables passed through to executed commands.
+  Env []string
+  // Audit lists the audit targets, see audit.Open. If nil, the default of
+  // audit.Syslog applies.
+  Audit []string
+  // Dirs and GroupDirs list the directories the user is confined to, the
+  // latter indexed by group name. Paths may start with "~".
+  Dirs      []string
+  GroupDirs map[string][]string
+  // Namespaces lists the namespaces commands are run in, see sandbox.Spec.
+  Namespaces []string
+  // Limits holds the resource limits of every command.
+  Limits limits.Limits
+  // Seccomp lists the seccomp profiles of every command.
+  Seccomp []string
+  Cgroups Cgroups
+  // Rescue is RescueExit or RescueRestart.
+  Rescue string
+  // Chroot is the root directory of the session, see ChrootDir.
+  Chroot string
+  // NoNewPrivs sets no_new_privs for every command.
+  NoNewPrivs bool
+  // Roles lists the roles of the user, see @role.
+  Roles []string
+  // Files lists the files read, in order.
+  Files []string
+  // Errors, if set, is called with every error in a line, and parsing goes
+  // on with the next line instead of stopping.
+  Errors func(err *ParseError)
+
+  // files is the stack of files being parsed, and line the number of the
+  // line being parsed in the innermost one.
+  files []string
+  line  int
+}
+
+// Cgroups configures the cgroups of a session and its commands.
+type Cgroups struct {
+  // Parent is the directory in which the cgroups of sessions are created.
+  // If empty, a default below the cgroup v2 mount point applies.
+  Parent string
+  // Session and Command hold the settings of the cgroups of the session
+  // and of every command. They are nil if no such cgroups are created.
+  Session cgroup.Settings
+  Command cgroup.Settings
+}
+
+// Enabled reports whether the session is placed in a cgroup.
+func (c *Cgroups) Enabled() bool {
+  return c.Session != nil || c.Command != nil
+}
+
+// Values of Config.Rescue.
+const (
+  RescueExit    = "exit"
+  RescueRestart = "restart"
+)
+
+// ParseError describes a problem in a configuration file.
+type ParseError struct {
+  File string
+  Line int
+  Msg  string
+}
+
+func (e *ParseError) Error() string {
+  return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+// New returns an empty configuration, which allows nothing but the builtins.
+func New() *Config {
+  return &Config{
+    Policy:    &policy.Policy{},
+    GroupDirs: map[string][]string{},
+    Limits:    limits.Limits{},
+    Rescue:    RescueExit,
+  }
+}
+
+// Load reads the configuration of the named user, who is a member of the
+// given groups: GlobalFile, then the files of the groups in GroupDir, then
+// the files of the roles of the user in RoleDir and finally the file of the
+// user in UserDir. Later files add to earlier ones. Missing files are skipped,
+// except for those of roles.
+func Load(username string, groups []string) (*Config, error) {
+  c := New()
+  files := Files(username, groups)
+  for _, path := range files[:len(files)-1] {
+    if err := c.parseOptionalFile(path); err != nil {
+      return nil, err
+    }
+  }
+  // The file of the user may give roles too, but is read last.
+  userFile := files[len(files)-1]
+  scratch := New()
+  if err := scratch.parseOptionalFile(userFile); err != nil {
+    return nil, err
+  }
+  if err := parseRole(c, scratch.Roles); err != nil {
+    return nil, err
+  }
+  // Role files may add roles while they are read.
+  for i := 0; i < len(c.Roles); i++ {
+    if err := c.ParseFile(filepath.Join(RoleDir, c.Roles[i])); err != nil {
+      return nil, fmt.Errorf("role %s: %v", c.Roles[i], err)
+    }
+  }
+  if err := c.parseOptionalFile(userFile); err != nil {
+    return nil, err
+  }
+  return c, nil
+}
+
+// Files returns the files Load reads for the named user, whether they exist
+// or not, in order: GlobalFile, the files of the groups and the file of the
+// user. The files of roles and included files are listed in Config.Files once
+// read.
+func Files(username string, groups []string) []string {
+  files := []string{GlobalFile}
+  for _, group := range groups {
+    files = append(files, filepath.Join(GroupDir, group))
+  }
+  return append(files, filepath.Join(UserDir, username))
+}
+
+func (c *Config) parseOptionalFile(path string) error {
+  if err := c.ParseFile(path); err != nil && !os.IsNotExist(err) {
+    return err
+  }
+  return nil
+}
+
+// ParseFile parses the named file into c.
+func (c *Config) ParseFile(path string) error {
+  f, err := os.Open(path)
+  if err != nil {
+    return err
+  }
+  defer f.Close()
+  c.Files = append(c.Files, path)
+  return c.Parse(f, path)
+}
+
+// Parse parses the configuration read from r into c. The name is used in
+// error messages and as the source of rules, and relative paths of @include
+// are relative to its directory. Parse stops at the first error unless
+// c.Errors is set.
+func (c *Config) Parse(r io.Reader, name string) error {
+  c.files = append(c.files, name)
+  outer := c.line
+  defer func() {
+    c.files, c.line = c.files[:len(c.files)-1], outer
+  }()
+  scanner := bufio.NewScanner(r)
+  for c.line = 1; scanner.Scan(); c.line++ {
+    err := c.ParseLine(scanner.Text())
+    if err == nil {
+      continue
+    }
+    // Errors from included files are located already.
+    perr, ok := err.(*ParseError)
+    if !ok {
+      perr = &ParseError{name, c.line, err.Error()}
+    }
+    if c.Errors == nil {
+      return perr
+    }
+    c.Errors(perr)
+  }
+  return scanner.Err()
+}
+
+// ParseLine parses a single line of a configuration file into c. Rules are
+// appended to c.Policy.
+func (c *Config) ParseLine(line string) error {
+  fields := strings.Fields(stripComment(line))
+  if len(fields) == 0 {
+    return nil
+  }
+  return c.parseLine(fields)
+}
+
+// directives maps directive names to the functions parsing their arguments.
+var directives = map[string]func(c *Config, args []string) error{
+  "env":        parseEnv,
+  "audit":      parseAudit,
+  "dir":        parseDir,
+  "groupdir":   parseGroupDir,
+  "namespace":  parseNamespace,
+  "limit":      parseLimit,
+  "seccomp":    parseSeccomp,
+  "cgroup":     parseCgroup,
+  "rescue":     parseRescue,
+  "chroot":     parseChroot,
+  "nonewprivs": parseNoNewPrivs,
+  "role":       parseRole,
+  "alias":      parseAlias,
+}
+
+func (c *Config) parseLine(fields []string) error {
+  if strings.HasPrefix(fields[0], "@") {
+    parse, ok := directives[fields[0][1:]]
+    if !ok {
+      return fmt.Errorf("unknown directive %s", fields[0])
+    }
+    return parse(c, fields[1:])
+  }
+  rule, err := policy.ParseRule(fields)
+  if err == policy.ErrNotFound {
+    // The program may yet be found once the root directory has changed, see
+    // @chroot.
+    logger.Printf("rule for %s matches nothing: %v", fields[0], err)
+  } else if err != nil {
+    return err
+  }
+  rule.Source = c.source()
+  c.Policy.Add(rule)
+  return nil
+}
+
+// source returns where the line being parsed comes from, if known.
+func (c *Config) source() string {
+  if len(c.files) == 0 {
+    return ""
+  }
+  return fmt.Sprintf("%s:%d", c.files[len(c.files)-1], c.line)
+}
+
+func stripComment(line string) string {
+  if i := strings.IndexByte(line, '#'); i >= 0 {
+    line = line[:i]
+  }
+  return strings.TrimSpace(line)
+}
+
+func parseEnv(c *Config, args []string) error {
+  if len(args) == 0 {
+    return errors.New("@env requires at least one variable name")
+  }
+  for _, name := range args {
+    if !isVarName(name) {
+      return fmt.Errorf("invalid variable name %q", name)
+    }
+  }
+  c.Env = append(c.Env, args...)
+  return nil
+}
+
+func parseAudit(c *Config, args []string) error {
+  if len(args) == 0 {
+    return errors.New("@audit requires at least one target")
+  }
+  if len(args) == 1 && args[0] == "none" {
+    c.Audit = []string{}
+    return nil
+  }
+  for _, target := range args {
+    if target != audit.Syslog && !filepath.IsAbs(target) {
+      return fmt.Errorf("invalid audit target %q", target)
+    }
+  }
+  c.Audit = append(c.Audit, args...)
+  return nil
+}
+
+func parseDir(c *Config, args []string) error {
+  if len(args) == 0 {
+    return errors.New("@dir requires at least one directory")
+  }
+  if err := checkDirs(args); err != nil {
+    return err
+  }
+  c.Dirs = append(c.Dirs, args...)
+  return nil
+}
+
+func parseGroupDir(c *Config, args []string) error {
+  if len(args) < 2 {
+    return errors.New("@groupdir requires a group and at least one directory")
+  }
+  if err := checkDirs(args[1:]); err != nil {
+    return err
+  }
+  c.GroupDirs[args[0]] = append(c.GroupDirs[args[0]], args[1:]...)
+  return nil
+}
+
+func checkDirs(dirs []string) error {
+  for _, dir := range dirs {
+    if !filepath.IsAbs(dir) && dir != "~" && !strings.HasPrefix(dir, "~/") {
+      return fmt.Errorf("directory must be absolute or start with ~: %s", dir)
+    }
+  }
+  return nil
+}
+
+func parseNamespace(c *Config, args []string) error {
+  if len(args) == 0 {
+    return errors.New("@namespace requires at least one namespace")
+  }
+  for _, name := range args {
+    if !contains(sandbox.Namespaces, name) {
+      return fmt.Errorf("unknown namespace %q", name)
+    }
+    if !contains(c.Namespaces, name) {
+      c.Namespaces = append(c.Namespaces, name)
+    }
+  }
+  return nil
+}
+
+func parseLimit(c *Config, args []string) error {
+  if len(args) == 0 {
+    return errors.New("@limit requires at least one limit")
+  }
+  for _, setting := range args {
+    if err := c.Limits.Set(setting); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func parseSeccomp(c *Config, args []string) error {
+  if len(args) == 0 {
+    return errors.New("@seccomp requires at least one profile")
+  }
+  for _, name := range args {
+    if _, ok := seccomp.Profiles[name]; !ok {
+      return fmt.Errorf("unknown seccomp profile %q", name)
+    }
+    if !contains(c.Seccomp, name) {
+      c.Seccomp = append(c.Seccomp, name)
+    }
+  }
+  return nil
+}
+
+func parseCgroup(c *Config, args []string) error {
+  if len(args) == 0 {
+    return errors.New("@cgroup requires session, command or parent")
+  }
+  var settings *cgroup.Settings
+  switch args[0] {
+  case "parent":
+    if len(args) != 2 || !filepath.IsAbs(args[1]) {
+      return errors.New("@cgroup parent requires an absolute directory")
+    }
+    c.Cgroups.Parent = args[1]
+    return nil
+  case "session":
+    settings = &c.Cgroups.Session
+  case "command":
+    settings = &c.Cgroups.Command
+  default:
+    return fmt.Errorf("@cgroup: unknown scope %q", args[0])
+  }
+  if *settings == nil {
+    *settings = cgroup.Settings{}
+  }
+  for _, setting := range args[1:] {
+    if err := settings.Set(setting); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func parseRescue(c *Config, args []string) error {
+  if len(args) != 1 || (args[0] != RescueExit && args[0] != RescueRestart) {
+    return errors.New("@rescue requires exit or restart")
+  }
+  c.Rescue = args[0]
+  return nil
+}
+
+func parseChroot(c *Config, args []string) error {
+  if len(args) != 1 {
+    return errors.New("@chroot requires exactly one directory")
+  }
+  if !filepath.IsAbs(args[0]) {
+    return fmt.Errorf("directory must be absolute: %s", args[0])
+  }
+  c.Chroot = args[0]
+  return nil
+}
+
+func parseNoNewPrivs(c *Config, args []string) error {
+  if len(args) != 0 {
+    return errors.New("@nonewprivs takes no arguments")
+  }
+  c.NoNewPrivs = true
+  return nil
+}
+
+func parseAlias(c *Config, args []string) error {
+  a, err := policy.ParseAlias(args)
+  if err == policy.ErrNotFound {
+    logger.Printf("alias %s runs nothing: %v", a.Name, err)
+  } else if err != nil {
+    return fmt.Errorf("@alias: %v", err)
+  }
+  a.Rule.Source = c.source()
+  return c.Policy.AddAlias(a)
+}
+
+func init() {
+  // Added here, as parsing an included file refers to directives.
+  directives["include"] = parseInclude
+}
+
+func parseInclude(c *Config, args []string) error {
+  if len(args) == 0 {
+    return errors.New("@include requires at least one file")
+  }
+  if len(c.files) > maxIncludeDepth {
+    return errors.New("@include nested too deeply")
+  }
+  for _, path := range args {
+    if !filepath.IsAbs(path) && len(c.files) > 0 {
+      path = filepath.Join(filepath.Dir(c.files[len(c.files)-1]), path)
+    }
+    if err := c.ParseFile(path); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func parseRole(c *Config, args []string) error {
+  for _, role := range args {
+    if !isFileName(role) {
+      return fmt.Errorf("invalid role %q", role)
+    }
+    if !contains(c.Roles, role) {
+      c.Roles = append(c.Roles, role)
+    }
+  }
+  return nil
+}
+
+// isFileName reports whether name may be used as the name of a file in a
+// directory, without leading anywhere else.
+func isFileName(name string) bool {
+  return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// ChrootDir returns the root directory of the named user's session, or "" if
+// no jail is configured.
+func (c *Config) ChrootDir(username string) string {
+  return strings.Replace(c.Chroot, "%u", username, -1)
+}
+
+func contains(list []string, s string) bool {
+  for _, x := range list {
+    if x == s {
+      return true
+    }
+  }
+  return false
+}
+
+func isVarName(name string) bool {
+  for i, r := range name {
+    if !(r == '_' || 'A' <= r && r <= 'Z' || 'a' <= r && r <= 'z' || i > 0 && '0' <= r && r <= '9') {
+      return false
+    }
+  }
+  return name != ""
+}
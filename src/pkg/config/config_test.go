@@ -0,0 +1,272 @@
+package config
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+const testConfig = `
+# allowed commands
+  /lish/test/date +%Y   # only the year
+/lish/test/du *
+
+sh	-c	true
+no-such-program-for-lish *
+`
+
+func TestParse(t *testing.T) {
+  c := New()
+  if err := c.Parse(strings.NewReader(testConfig), "test"); err != nil {
+    t.Fatalf("Parse => %v, want <nil>", err)
+  }
+  rules := c.Policy.Rules
+  if len(rules) != 4 {
+    t.Fatalf("Parse => %d rules, want 4", len(rules))
+  }
+  if s := rules[0].String(); s != "/lish/test/date +%Y" {
+    t.Errorf("rules[0] => %q, want %q", s, "/lish/test/date +%Y")
+  }
+  if s := rules[1].String(); s != "/lish/test/du *" {
+    t.Errorf("rules[1] => %q, want %q", s, "/lish/test/du *")
+  }
+  if !strings.HasSuffix(rules[2].Path, "/sh") || strings.Join(rules[2].Args, " ") != "-c true" {
+    t.Errorf("rules[2] => %q, want sh resolved in PATH with args -c true", rules[2])
+  }
+  if rules[3].Path != "" {
+    t.Errorf("rules[3] => %q, want unresolved", rules[3])
+  }
+}
+
+func TestParseError(t *testing.T) {
+  err := New().Parse(strings.NewReader("/lish/test/date\n/lish/test/du * -h\n"), "test")
+  perr, ok := err.(*ParseError)
+  if !ok || perr.Line != 2 {
+    t.Errorf("Parse => %v, want ParseError on line 2", err)
+  }
+}
+
+func TestParseErrors(t *testing.T) {
+  c := New()
+  var lines []int
+  c.Errors = func(err *ParseError) {
+    lines = append(lines, err.Line)
+  }
+  err := c.Parse(strings.NewReader("@nosuch\n/lish/test/date\n@env\n"), "test")
+  if err != nil || len(lines) != 2 || lines[0] != 1 || lines[1] != 3 || len(c.Policy.Rules) != 1 {
+    t.Errorf("Parse => %v, errors on lines %v, rules %v; want errors on lines 1 and 3, 1 rule", err, lines, c.Policy.Rules)
+  }
+}
+
+func TestParseEnv(t *testing.T) {
+  c := New()
+  err := c.Parse(strings.NewReader("@env LANG TERM\n@env LC_ALL\n"), "test")
+  if err != nil || strings.Join(c.Env, " ") != "LANG TERM LC_ALL" {
+    t.Errorf("Parse => (%q, %v), want ([LANG TERM LC_ALL], <nil>)", c.Env, err)
+  }
+  for _, line := range []string{"@env", "@env LD-PRELOAD", "@env 1X", "@nosuch x"} {
+    if err := New().Parse(strings.NewReader(line), "test"); err == nil {
+      t.Errorf("Parse(%q) => <nil>, want error", line)
+    }
+  }
+}
+
+func TestParseAudit(t *testing.T) {
+  c := New()
+  if c.Audit != nil {
+    t.Errorf("New().Audit => %q, want nil", c.Audit)
+  }
+  c.Parse(strings.NewReader("@audit syslog /var/log/lish.json\n"), "test")
+  if strings.Join(c.Audit, " ") != "syslog /var/log/lish.json" {
+    t.Errorf("Audit => %q, want [syslog /var/log/lish.json]", c.Audit)
+  }
+  c.Parse(strings.NewReader("@audit none\n"), "test")
+  if c.Audit == nil || len(c.Audit) != 0 {
+    t.Errorf("Audit after @audit none => %q, want empty", c.Audit)
+  }
+  if err := New().Parse(strings.NewReader("@audit lish.json\n"), "test"); err == nil {
+    t.Error("Parse with relative audit file => <nil>, want error")
+  }
+}
+
+func TestParseDirs(t *testing.T) {
+  c := New()
+  err := c.Parse(strings.NewReader("@dir ~ /srv/www\n@groupdir ops /srv/ops ~/ops\n"), "test")
+  if err != nil {
+    t.Fatalf("Parse => %v, want <nil>", err)
+  }
+  if strings.Join(c.Dirs, " ") != "~ /srv/www" {
+    t.Errorf("Dirs => %q, want [~ /srv/www]", c.Dirs)
+  }
+  if strings.Join(c.GroupDirs["ops"], " ") != "/srv/ops ~/ops" {
+    t.Errorf("GroupDirs[ops] => %q, want [/srv/ops ~/ops]", c.GroupDirs["ops"])
+  }
+  for _, line := range []string{"@dir", "@dir srv", "@groupdir ops", "@dir ~alice"} {
+    if err := New().Parse(strings.NewReader(line), "test"); err == nil {
+      t.Errorf("Parse(%q) => <nil>, want error", line)
+    }
+  }
+}
+
+func TestParseNamespace(t *testing.T) {
+  c := New()
+  err := c.Parse(strings.NewReader("@namespace mount pid\n@namespace pid net\n"), "test")
+  if err != nil || strings.Join(c.Namespaces, " ") != "mount pid net" {
+    t.Errorf("Parse => (%q, %v), want ([mount pid net], <nil>)", c.Namespaces, err)
+  }
+  if err := New().Parse(strings.NewReader("@namespace time\n"), "test"); err == nil {
+    t.Error("Parse with unknown namespace => <nil>, want error")
+  }
+}
+
+func TestParseChroot(t *testing.T) {
+  c := New()
+  if err := c.Parse(strings.NewReader("@chroot /srv/jail/%u\n"), "test"); err != nil {
+    t.Fatalf("Parse => %v, want <nil>", err)
+  }
+  if dir := c.ChrootDir("alice"); dir != "/srv/jail/alice" {
+    t.Errorf("ChrootDir => %q, want %q", dir, "/srv/jail/alice")
+  }
+  for _, line := range []string{"@chroot\n", "@chroot jail\n", "@chroot /a /b\n"} {
+    if err := New().Parse(strings.NewReader(line), "test"); err == nil {
+      t.Errorf("Parse(%q) => <nil>, want error", line)
+    }
+  }
+}
+
+func TestParseLimit(t *testing.T) {
+  c := New()
+  err := c.Parse(strings.NewReader("@limit cpu=10 nofile=64\n@limit cpu=20\n"), "test")
+  if err != nil || c.Limits.String() != "cpu=20,nofile=64" {
+    t.Errorf("Parse => (%v, %v), want (cpu=20,nofile=64, <nil>)", c.Limits, err)
+  }
+  if err := New().Parse(strings.NewReader("@limit core=0\n"), "test"); err == nil {
+    t.Error("Parse with unknown limit => <nil>, want error")
+  }
+}
+
+func TestParseCgroup(t *testing.T) {
+  c := New()
+  if c.Cgroups.Enabled() {
+    t.Error("Cgroups.Enabled() => true without @cgroup")
+  }
+  err := c.Parse(strings.NewReader("@cgroup command\n@cgroup session pids.max=100 memory.max=1G\n@cgroup parent /sys/fs/cgroup/lish\n"), "test")
+  if err != nil {
+    t.Fatalf("Parse => %v, want <nil>", err)
+  }
+  if !c.Cgroups.Enabled() || c.Cgroups.Command == nil || len(c.Cgroups.Session) != 2 || c.Cgroups.Parent != "/sys/fs/cgroup/lish" {
+    t.Errorf("Parse => %+v, want session and command cgroups below /sys/fs/cgroup/lish", c.Cgroups)
+  }
+  for _, line := range []string{"@cgroup\n", "@cgroup user\n", "@cgroup parent lish\n", "@cgroup session io.max=1\n"} {
+    if err := New().Parse(strings.NewReader(line), "test"); err == nil {
+      t.Errorf("Parse(%q) => <nil>, want error", line)
+    }
+  }
+}
+
+func TestParseSeccomp(t *testing.T) {
+  c := New()
+  err := c.Parse(strings.NewReader("@seccomp no-network\n@seccomp read-only no-network\n"), "test")
+  if err != nil || strings.Join(c.Seccomp, " ") != "no-network read-only" {
+    t.Errorf("Parse => (%q, %v), want ([no-network read-only], <nil>)", c.Seccomp, err)
+  }
+  if err := New().Parse(strings.NewReader("@seccomp everything\n"), "test"); err == nil {
+    t.Error("Parse with unknown profile => <nil>, want error")
+  }
+}
+
+func TestParseRescue(t *testing.T) {
+  c := New()
+  if c.Rescue != RescueExit {
+    t.Errorf("Rescue => %q, want %q by default", c.Rescue, RescueExit)
+  }
+  if err := c.Parse(strings.NewReader("@rescue restart\n"), "test"); err != nil || c.Rescue != RescueRestart {
+    t.Errorf("Parse => (%q, %v), want (%q, <nil>)", c.Rescue, err, RescueRestart)
+  }
+  if err := New().Parse(strings.NewReader("@rescue shell\n"), "test"); err == nil {
+    t.Error("Parse(@rescue shell) => <nil>, want error")
+  }
+}
+
+func TestParseNoNewPrivs(t *testing.T) {
+  c := New()
+  if err := c.Parse(strings.NewReader("@nonewprivs\n"), "test"); err != nil || !c.NoNewPrivs {
+    t.Errorf("Parse => (%v, %v), want (true, <nil>)", c.NoNewPrivs, err)
+  }
+  if err := New().Parse(strings.NewReader("@nonewprivs yes\n"), "test"); err == nil {
+    t.Error("Parse(@nonewprivs yes) => <nil>, want error")
+  }
+}
+
+func TestParseAlias(t *testing.T) {
+  c := New()
+  err := c.Parse(strings.NewReader("@alias list <dir:word> = ls {dir} @noescape\n"), "test")
+  a := c.Policy.Alias("list")
+  if err != nil || a == nil || len(c.Policy.Rules) != 1 || c.Policy.Rules[0].Source != "test:1" {
+    t.Fatalf("Parse => (%v, %v), want alias with a rule from test:1", c.Policy.Rules, err)
+  }
+  if !a.Rule.NoEscape {
+    t.Error("rule of alias lacks @noescape")
+  }
+  if err := c.Parse(strings.NewReader("@alias list = ls\n"), "test"); err == nil {
+    t.Error("Parse of a second alias list => <nil>, want error")
+  }
+}
+
+func TestParseInclude(t *testing.T) {
+  dir, err := ioutil.TempDir("", "lish")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  write := func(name, content string) string {
+    path := filepath.Join(dir, name)
+    if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+      t.Fatal(err)
+    }
+    return path
+  }
+  write("common", "sh -c true\n!sh -c false\n")
+  main := write("main", "# includes\n@include common\nsh -c ls\n")
+  c := New()
+  if err := c.ParseFile(main); err != nil {
+    t.Fatalf("ParseFile => %v, want <nil>", err)
+  }
+  if len(c.Policy.Rules) != 2 || len(c.Policy.Deny) != 1 {
+    t.Fatalf("ParseFile => %v allow, %v deny, want 2 and 1", c.Policy.Rules, c.Policy.Deny)
+  }
+  for _, tt := range []struct{ got, want string }{
+    {c.Policy.Rules[0].Source, filepath.Join(dir, "common") + ":1"},
+    {c.Policy.Deny[0].Source, filepath.Join(dir, "common") + ":2"},
+    {c.Policy.Rules[1].Source, main + ":3"},
+    {strings.Join(c.Files, " "), main + " " + filepath.Join(dir, "common")},
+  } {
+    if tt.got != tt.want {
+      t.Errorf("got %q, want %q", tt.got, tt.want)
+    }
+  }
+
+  loop := write("loop", "@include loop\n")
+  if err := New().ParseFile(loop); err == nil {
+    t.Error("ParseFile with an include loop => <nil>, want error")
+  }
+  bad := write("bad", "@include common\n@include missing\n")
+  if perr, ok := New().ParseFile(bad).(*ParseError); !ok || perr.Line != 2 {
+    t.Errorf("ParseFile with a missing include => %v, want ParseError on line 2", perr)
+  }
+}
+
+func TestParseRole(t *testing.T) {
+  c := New()
+  err := c.Parse(strings.NewReader("@role dba ops\n@role dba\n"), "test")
+  if err != nil || strings.Join(c.Roles, " ") != "dba ops" {
+    t.Errorf("Parse => (%q, %v), want ([dba ops], <nil>)", c.Roles, err)
+  }
+  for _, line := range []string{"@role ../admin\n", "@role ..\n"} {
+    if err := New().Parse(strings.NewReader(line), "test"); err == nil {
+      t.Errorf("Parse(%q) => <nil>, want error", line)
+    }
+  }
+}
@@ -0,0 +1,215 @@
+// Package jail checks and enters chroot jails.
+package jail
+
+import (
+  "bufio"
+  "debug/elf"
+  "errors"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+  "syscall"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/policy"
+)
+
+// maxSymlinks bounds the number of symbolic links followed when resolving a
+// path, like the kernel does.
+const maxSymlinks = 40
+
+// libraryDirs are searched for shared libraries that are not found in the
+// run path of an executable.
+var libraryDirs = []string{
+  "/lib", "/usr/lib", "/lib64", "/usr/lib64", "/usr/local/lib",
+  "/lib/x86_64-linux-gnu", "/usr/lib/x86_64-linux-gnu",
+  "/lib/aarch64-linux-gnu", "/usr/lib/aarch64-linux-gnu",
+}
+
+// Check verifies that each of the programs, given as in a rule, exists below
+// root together with everything it needs to run: the ELF interpreter and
+// shared libraries of dynamically linked executables, and the interpreter of
+// scripts. Paths are resolved as they will be once root is the root
+// directory, so absolute symbolic links within the jail are followed within
+// the jail.
+func Check(root string, programs []string) error {
+  info, err := os.Stat(root)
+  if err != nil {
+    return err
+  }
+  if !info.IsDir() {
+    return fmt.Errorf("%s: not a directory", root)
+  }
+  c := &checker{root: root, checked: map[string]bool{}}
+  for _, program := range programs {
+    if err := c.program(program); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// Enter makes root the root directory and changes to it.
+func Enter(root string) error {
+  if err := syscall.Chroot(root); err != nil {
+    return err
+  }
+  return os.Chdir("/")
+}
+
+type checker struct {
+  root    string
+  checked map[string]bool
+}
+
+func (c *checker) program(name string) error {
+  path := name
+  if !strings.Contains(name, "/") {
+    path = c.lookPath(name)
+    if path == "" {
+      return fmt.Errorf("%s: not found in %s of the jail", name, policy.DefaultPath)
+    }
+  }
+  return c.executable(path)
+}
+
+func (c *checker) lookPath(name string) string {
+  for _, dir := range filepath.SplitList(policy.DefaultPath) {
+    path := filepath.Join(dir, name)
+    if _, err := c.resolve(path); err == nil {
+      return path
+    }
+  }
+  return ""
+}
+
+// executable checks a program given by its path within the jail.
+func (c *checker) executable(path string) error {
+  hostPath, err := c.resolve(path)
+  if err != nil {
+    return fmt.Errorf("%s: %v", path, err)
+  }
+  if c.checked[hostPath] {
+    return nil
+  }
+  c.checked[hostPath] = true
+  f, err := elf.Open(hostPath)
+  if err != nil {
+    return c.script(path, hostPath)
+  }
+  defer f.Close()
+  return c.elf(path, f)
+}
+
+// script checks the interpreter named by the "#!" line of a script, if any.
+func (c *checker) script(path, hostPath string) error {
+  f, err := os.Open(hostPath)
+  if err != nil {
+    return fmt.Errorf("%s: %v", path, err)
+  }
+  defer f.Close()
+  line, _ := bufio.NewReader(f).ReadString('\n')
+  if !strings.HasPrefix(line, "#!") {
+    return nil
+  }
+  fields := strings.Fields(line[2:])
+  if len(fields) == 0 {
+    return fmt.Errorf("%s: empty interpreter line", path)
+  }
+  if err := c.executable(fields[0]); err != nil {
+    return fmt.Errorf("%s: interpreter %v", path, err)
+  }
+  return nil
+}
+
+// elf checks the interpreter and shared libraries of an ELF object.
+func (c *checker) elf(path string, f *elf.File) error {
+  for _, prog := range f.Progs {
+    if prog.Type != elf.PT_INTERP {
+      continue
+    }
+    data := make([]byte, prog.Filesz)
+    if _, err := prog.ReadAt(data, 0); err != nil {
+      return fmt.Errorf("%s: reading interpreter: %v", path, err)
+    }
+    interp := strings.TrimRight(string(data), "\x00")
+    if err := c.executable(interp); err != nil {
+      return fmt.Errorf("%s: interpreter %v", path, err)
+    }
+  }
+
+  libs, err := f.ImportedLibraries()
+  if err != nil {
+    // Not dynamically linked.
+    return nil
+  }
+  var dirs []string
+  for _, tag := range []elf.DynTag{elf.DT_RUNPATH, elf.DT_RPATH} {
+    paths, _ := f.DynString(tag)
+    for _, p := range paths {
+      for _, dir := range filepath.SplitList(p) {
+        dirs = append(dirs, strings.Replace(dir, "$ORIGIN", filepath.Dir(path), -1))
+      }
+    }
+  }
+  dirs = append(dirs, libraryDirs...)
+  for _, lib := range libs {
+    if err := c.library(lib, dirs); err != nil {
+      return fmt.Errorf("%s: %v", path, err)
+    }
+  }
+  return nil
+}
+
+func (c *checker) library(name string, dirs []string) error {
+  if strings.Contains(name, "/") {
+    return c.executable(name)
+  }
+  for _, dir := range dirs {
+    path := filepath.Join(dir, name)
+    if _, err := c.resolve(path); err == nil {
+      return c.executable(path)
+    }
+  }
+  return fmt.Errorf("shared library %s not found", name)
+}
+
+// resolve returns the path on the host of a path within the jail, following
+// symbolic links relative to the root of the jail.
+func (c *checker) resolve(path string) (string, error) {
+  parts := strings.Split(path, "/")
+  cur := "/"
+  for links := 0; len(parts) > 0; {
+    part := parts[0]
+    parts = parts[1:]
+    if part == "" || part == "." {
+      continue
+    }
+    if part == ".." {
+      cur = filepath.Dir(cur)
+      continue
+    }
+    next := filepath.Join(cur, part)
+    hostPath := filepath.Join(c.root, next)
+    info, err := os.Lstat(hostPath)
+    if err != nil {
+      return "", errors.New("not found in the jail")
+    }
+    if info.Mode()&os.ModeSymlink == 0 {
+      cur = next
+      continue
+    }
+    if links++; links > maxSymlinks {
+      return "", errors.New("too many levels of symbolic links")
+    }
+    target, err := os.Readlink(hostPath)
+    if err != nil {
+      return "", err
+    }
+    if filepath.IsAbs(target) {
+      cur = "/"
+    }
+    parts = append(strings.Split(target, "/"), parts...)
+  }
+  return filepath.Join(c.root, cur), nil
+}
@@ -0,0 +1,69 @@
+package jail
+
+import (
+  "debug/elf"
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestCheck(t *testing.T) {
+  root, err := ioutil.TempDir("", "lish.jail")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(root)
+  mkfile := func(path, content string) {
+    path = filepath.Join(root, path)
+    os.MkdirAll(filepath.Dir(path), 0755)
+    if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+      t.Fatal(err)
+    }
+  }
+  mkfile("/bin/plain", "not a script\n")
+  mkfile("/bin/script", "#!/bin/plain -x\n")
+  mkfile("/bin/broken", "#!/bin/missing\n")
+  os.MkdirAll(filepath.Join(root, "usr/bin"), 0755)
+  // An absolute link must be followed within the jail, not on the host.
+  os.Symlink("/bin/script", filepath.Join(root, "usr/bin/link"))
+
+  if err := Check(root, []string{"plain", "/bin/script", "/usr/bin/link"}); err != nil {
+    t.Errorf("Check => %v, want <nil>", err)
+  }
+  for _, program := range []string{"broken", "missing", "/usr/bin/plain"} {
+    if err := Check(root, []string{program}); err == nil {
+      t.Errorf("Check(%q) => <nil>, want error", program)
+    }
+  }
+}
+
+func TestCheckMissingLibraries(t *testing.T) {
+  f, err := elf.Open("/bin/sh")
+  if err != nil {
+    t.Skip("/bin/sh is not an ELF file")
+  }
+  libs, _ := f.ImportedLibraries()
+  f.Close()
+  if len(libs) == 0 {
+    t.Skip("/bin/sh is not dynamically linked")
+  }
+
+  root, err := ioutil.TempDir("", "lish.jail")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(root)
+  sh, err := ioutil.ReadFile("/bin/sh")
+  if err != nil {
+    t.Fatal(err)
+  }
+  os.MkdirAll(filepath.Join(root, "bin"), 0755)
+  ioutil.WriteFile(filepath.Join(root, "bin/sh"), sh, 0755)
+
+  err = Check(root, []string{"/bin/sh"})
+  if err == nil || !strings.HasPrefix(err.Error(), "/bin/sh: ") {
+    t.Errorf("Check of /bin/sh without libraries => %v, want error", err)
+  }
+}
@@ -0,0 +1,127 @@
+// Package lexer splits a command line into commands and their words.
+//
+// The supported syntax is a small subset of the POSIX shell: words are
+// separated by blanks, commands by ';', and single quotes, double quotes and
+// backslashes can be used to quote. Operators for pipes, redirections,
+// background jobs and command substitution are rejected instead of being
+// taken literally, so that there is never any doubt about whether they were
+// interpreted.
+package lexer
+
+import "fmt"
+
+// Error is returned for command lines that cannot be split.
+type Error struct {
+  Pos int
+  Msg string
+}
+
+func (e *Error) Error() string {
+  return fmt.Sprintf("%s (at offset %d)", e.Msg, e.Pos)
+}
+
+var unsupported = map[byte]string{
+  '|': "pipes are not supported",
+  '>': "redirections are not supported",
+  '<': "redirections are not supported",
+  '&': "background jobs and '&&' are not supported",
+  '`': "command substitution is not supported",
+}
+
+// Split splits line into ';'-separated commands, each being a list of words.
+// Commands without any word are dropped.
+func Split(line string) ([][]string, error) {
+  var (
+    cmds [][]string
+    cmd  []string
+    word []byte
+    // inWord is set once a word has been started, so that quoted empty
+    // strings are kept as empty words.
+    inWord bool
+  )
+  endWord := func() {
+    if inWord {
+      cmd = append(cmd, string(word))
+    }
+    word, inWord = nil, false
+  }
+  endCmd := func() {
+    endWord()
+    if len(cmd) > 0 {
+      cmds = append(cmds, cmd)
+    }
+    cmd = nil
+  }
+
+  for i := 0; i < len(line); i++ {
+    c := line[i]
+    switch {
+    case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+      endWord()
+    case c == ';':
+      endCmd()
+    case c == '\\':
+      if i+1 == len(line) {
+        return nil, &Error{i, "trailing backslash"}
+      }
+      i++
+      word, inWord = append(word, line[i]), true
+    case c == '\'':
+      end := i + 1
+      for end < len(line) && line[end] != '\'' {
+        end++
+      }
+      if end == len(line) {
+        return nil, &Error{i, "unterminated single quote"}
+      }
+      word, inWord = append(word, line[i+1:end]...), true
+      i = end
+    case c == '"':
+      start := i
+      inWord = true
+      for i++; ; i++ {
+        if i == len(line) {
+          return nil, &Error{start, "unterminated double quote"}
+        }
+        c = line[i]
+        if c == '"' {
+          break
+        }
+        if err := checkSubstitution(line, i); err != nil {
+          return nil, err
+        }
+        if c == '\\' && i+1 < len(line) && isDoubleQuoteEscape(line[i+1]) {
+          i++
+          c = line[i]
+        }
+        word = append(word, c)
+      }
+    default:
+      if msg, ok := unsupported[c]; ok {
+        return nil, &Error{i, msg}
+      }
+      if err := checkSubstitution(line, i); err != nil {
+        return nil, err
+      }
+      word, inWord = append(word, c), true
+    }
+  }
+  endCmd()
+  return cmds, nil
+}
+
+// checkSubstitution rejects "$(" and backquotes, which a POSIX shell would
+// interpret even inside double quotes.
+func checkSubstitution(line string, i int) error {
+  if line[i] == '`' || (line[i] == '$' && i+1 < len(line) && line[i+1] == '(') {
+    return &Error{i, "command substitution is not supported"}
+  }
+  return nil
+}
+
+// isDoubleQuoteEscape reports whether a backslash followed by c is an escape
+// sequence inside double quotes. Before any other character the backslash is
+// taken literally.
+func isDoubleQuoteEscape(c byte) bool {
+  return c == '"' || c == '\\' || c == '$' || c == '`'
+}
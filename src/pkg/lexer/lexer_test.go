@@ -0,0 +1,63 @@
+package lexer
+
+import (
+  "reflect"
+  "testing"
+)
+
+var splits = []struct {
+  line string
+  want [][]string
+}{
+  {"", nil},
+  {"  ;; ", nil},
+  {"date +%Y", [][]string{{"date", "+%Y"}}},
+  {"date; id", [][]string{{"date"}, {"id"}}},
+  {"cd /; pwd;", [][]string{{"cd", "/"}, {"pwd"}}},
+  {`grep "two words" file`, [][]string{{"grep", "two words", "file"}}},
+  {`grep 'a;b' file`, [][]string{{"grep", "a;b", "file"}}},
+  {`echo "" ''`, [][]string{{"echo", "", ""}}},
+  {`echo a\ b \;`, [][]string{{"echo", "a b", ";"}}},
+  {`echo "a\"b" "\x" 'c\d'`, [][]string{{"echo", `a"b`, `\x`, `c\d`}}},
+  {`echo "a|b>c" 'x&&y' \|`, [][]string{{"echo", "a|b>c", "x&&y", "|"}}},
+  {`echo '$(id)' "\$(id)" $HOME`, [][]string{{"echo", "$(id)", "$(id)", "$HOME"}}},
+  {"echo pre\"fix\"'ed'", [][]string{{"echo", "prefixed"}}},
+}
+
+func TestSplit(t *testing.T) {
+  for _, tt := range splits {
+    got, err := Split(tt.line)
+    if err != nil || !reflect.DeepEqual(got, tt.want) {
+      t.Errorf("Split(%q) => (%q, %v), want (%q, <nil>)",
+        tt.line, got, err, tt.want)
+    }
+  }
+}
+
+var rejects = []struct {
+  line string
+  pos  int
+}{
+  {"ls | sh", 3},
+  {"ls > out", 3},
+  {"sh < in", 3},
+  {"date && id", 5},
+  {"date &", 5},
+  {"echo $(id)", 5},
+  {"echo `id`", 5},
+  {`echo "$(id)"`, 6},
+  {"echo 'unterminated", 5},
+  {`echo "unterminated`, 5},
+  {`echo \`, 5},
+}
+
+func TestSplitRejects(t *testing.T) {
+  for _, tt := range rejects {
+    got, err := Split(tt.line)
+    lerr, ok := err.(*Error)
+    if !ok || lerr.Pos != tt.pos {
+      t.Errorf("Split(%q) => (%q, %v), want error at offset %d",
+        tt.line, got, err, tt.pos)
+    }
+  }
+}
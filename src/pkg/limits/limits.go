@@ -0,0 +1,130 @@
+// Package limits describes the resource limits of commands.
+package limits
+
+import (
+  "errors"
+  "fmt"
+  "math"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// Names lists the known limits:
+//
+//	cpu      CPU time, as a duration or in seconds (RLIMIT_CPU)
+//	as       size of the address space in bytes, with an optional K, M, G
+//	         or T suffix (RLIMIT_AS)
+//	nproc    number of processes of the user (RLIMIT_NPROC)
+//	nofile   number of open files (RLIMIT_NOFILE)
+//	fsize    size of written files, like as (RLIMIT_FSIZE)
+//	timeout  wall-clock time, like cpu, after which the process group of
+//	         the command is killed
+var Names = []string{"cpu", "as", "nproc", "nofile", "fsize", "timeout"}
+
+// Timeout is the name of the only limit that is not a resource limit of the
+// kernel.
+const Timeout = "timeout"
+
+// Limits maps the names of limits to their values, in seconds, bytes or
+// counts. Absent limits are not enforced.
+type Limits map[string]uint64
+
+// Set parses a setting of the form "name=value" into l.
+func (l Limits) Set(setting string) error {
+  i := strings.IndexByte(setting, '=')
+  if i < 0 {
+    return fmt.Errorf("limit %q: missing value", setting)
+  }
+  name, value := setting[:i], setting[i+1:]
+  var n uint64
+  var err error
+  switch name {
+  case "cpu", Timeout:
+    n, err = parseSeconds(value)
+  case "as", "fsize":
+    n, err = parseSize(value)
+  case "nproc", "nofile":
+    n, err = strconv.ParseUint(value, 10, 64)
+  default:
+    return fmt.Errorf("unknown limit %q", name)
+  }
+  if err != nil {
+    return fmt.Errorf("limit %s: invalid value %q", name, value)
+  }
+  l[name] = n
+  return nil
+}
+
+// Merge returns the limits of l overridden by those of other.
+func Merge(l, other Limits) Limits {
+  merged := Limits{}
+  for name, value := range l {
+    merged[name] = value
+  }
+  for name, value := range other {
+    merged[name] = value
+  }
+  return merged
+}
+
+// Timeout returns the wall-clock limit, or 0 if there is none.
+func (l Limits) Timeout() time.Duration {
+  return time.Duration(l[Timeout]) * time.Second
+}
+
+// HasRlimits reports whether l contains limits enforced by the kernel, which
+// have to be set up in the process of the command.
+func (l Limits) HasRlimits() bool {
+  for name := range l {
+    if name != Timeout {
+      return true
+    }
+  }
+  return false
+}
+
+func (l Limits) String() string {
+  var settings []string
+  for _, name := range Names {
+    if value, ok := l[name]; ok {
+      settings = append(settings, fmt.Sprintf("%s=%d", name, value))
+    }
+  }
+  return strings.Join(settings, ",")
+}
+
+// parseSeconds parses a duration or a plain number of seconds, rounding up to
+// whole seconds.
+func parseSeconds(s string) (uint64, error) {
+  if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+    return n, nil
+  }
+  d, err := time.ParseDuration(s)
+  if err != nil {
+    return 0, err
+  }
+  if d < 0 {
+    return 0, errors.New("negative duration")
+  }
+  return uint64((d + time.Second - 1) / time.Second), nil
+}
+
+// parseSize parses a number of bytes with an optional binary suffix.
+func parseSize(s string) (uint64, error) {
+  shift := uint(0)
+  if s != "" {
+    if i := strings.IndexByte("KMGT", s[len(s)-1]); i >= 0 {
+      shift = 10 * uint(i+1)
+      s = s[:len(s)-1]
+    }
+  }
+  n, err := strconv.ParseUint(s, 10, 64)
+  if err != nil {
+    return 0, err
+  }
+  if n > math.MaxUint64>>shift {
+    return 0, errors.New("size out of range")
+  }
+  return n << shift, nil
+}
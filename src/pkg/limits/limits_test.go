@@ -0,0 +1,37 @@
+package limits
+
+import (
+  "testing"
+  "time"
+)
+
+func TestSet(t *testing.T) {
+  l := Limits{}
+  for _, setting := range []string{"cpu=1m30s", "as=512M", "nproc=20", "nofile=64", "fsize=10", "timeout=1.5s"} {
+    if err := l.Set(setting); err != nil {
+      t.Errorf("Set(%q) => %v, want <nil>", setting, err)
+    }
+  }
+  want := "cpu=90,as=536870912,nproc=20,nofile=64,fsize=10,timeout=2"
+  if s := l.String(); s != want {
+    t.Errorf("Limits => %q, want %q", s, want)
+  }
+  if d := l.Timeout(); d != 2*time.Second {
+    t.Errorf("Timeout => %v, want 2s", d)
+  }
+  for _, setting := range []string{"cpu", "core=0", "as=1X", "nproc=-1", "timeout=-1s", "fsize=99999999999T"} {
+    if err := l.Set(setting); err == nil {
+      t.Errorf("Set(%q) => <nil>, want error", setting)
+    }
+  }
+}
+
+func TestMerge(t *testing.T) {
+  l := Merge(Limits{"cpu": 10, "nofile": 64}, Limits{"cpu": 20, "timeout": 5})
+  if s := l.String(); s != "cpu=20,nofile=64,timeout=5" {
+    t.Errorf("Merge => %q, want %q", s, "cpu=20,nofile=64,timeout=5")
+  }
+  if !l.HasRlimits() || (Limits{"timeout": 5}).HasRlimits() {
+    t.Error("HasRlimits does not ignore the timeout")
+  }
+}
@@ -0,0 +1,356 @@
+// Package lint finds problems in configuration files: syntax errors, rules for
+// programs that cannot be found, rules that never match because of earlier
+// ones, programs that others than root may replace and rules allowing more than
+// they appear to.
+package lint
+
+import (
+  "fmt"
+  "io"
+  "os"
+  "path/filepath"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/config"
+  "github.com/m9rco/phoenix-shell/src/pkg/policy"
+  "github.com/m9rco/phoenix-shell/src/pkg/seccomp"
+)
+
+// Severities of findings. Errors should be fixed before a file is put to
+// use, warnings deserve a second look.
+const (
+  Error   = "error"
+  Warning = "warning"
+)
+
+// Finding is a problem found on a line of a configuration file.
+type Finding struct {
+  File     string `json:"file"`
+  Line     int    `json:"line"`
+  Severity string `json:"severity"`
+  Message  string `json:"message"`
+}
+
+func (f *Finding) String() string {
+  return fmt.Sprintf("%s:%d: %s: %s", f.File, f.Line, f.Severity, f.Message)
+}
+
+// shells and interpreters run whatever code they are given.
+var shells = []string{
+  "sh", "ash", "bash", "dash", "ksh", "mksh", "zsh", "csh", "tcsh", "fish", "busybox",
+}
+
+var interpreters = []string{
+  "python", "perl", "ruby", "node", "nodejs", "php", "lua", "tclsh", "wish",
+  "awk", "gawk", "mawk", "nawk", "expect", "gdb", "irb",
+}
+
+// runners run the command given in their arguments.
+var runners = []string{
+  "env", "xargs", "sudo", "su", "doas", "nohup", "nice", "ionice", "timeout",
+  "setsid", "stdbuf", "chroot", "watch", "strace", "ltrace", "time",
+}
+
+// escapes have a command to start a shell, see the @noescape rule option.
+var escapes = []string{"vi", "vim", "view", "vimdiff", "ex", "nvim", "less", "more", "man"}
+
+// findExec lists the options of find that run commands.
+var findExec = []string{"-exec", "-execdir", "-ok", "-okdir"}
+
+// File lints the named file.
+func File(path string) ([]Finding, error) {
+  f, err := os.Open(path)
+  if err != nil {
+    return nil, err
+  }
+  defer f.Close()
+  return Lint(f, path)
+}
+
+// Lint lints the configuration read from r. The name is used in findings,
+// and relative paths of @include are relative to its directory. Unlike
+// config.Parse, it goes on after syntax errors.
+func Lint(r io.Reader, name string) ([]Finding, error) {
+  l := &linter{cfg: config.New(), order: map[string]int{name: 0}}
+  l.cfg.Errors = func(err *config.ParseError) {
+    l.report(location{err.File, err.Line}, Error, "%s", err.Msg)
+  }
+  if err := l.cfg.Parse(r, name); err != nil {
+    return nil, err
+  }
+  for i, file := range l.cfg.Files {
+    if _, ok := l.order[file]; !ok {
+      l.order[file] = i + 1
+    }
+  }
+  rules := l.cfg.Policy.Rules
+  for i, rule := range rules {
+    l.checkRule(rules[:i], rule)
+    l.checkPatterns(rule)
+    // Whether @chroot or @seccomp apply is only known at the end.
+    l.checkProgram(rule)
+    l.checkDangerous(rule)
+  }
+  for _, rule := range l.cfg.Policy.Deny {
+    l.checkPatterns(rule)
+    l.checkDeny(rule)
+  }
+  sort.SliceStable(l.findings, func(i, j int) bool {
+    a, b := &l.findings[i], &l.findings[j]
+    if a.File != b.File {
+      return l.order[a.File] < l.order[b.File]
+    }
+    return a.Line < b.Line
+  })
+  return l.findings, nil
+}
+
+type linter struct {
+  cfg *config.Config
+  // order ranks files in the order they were read, for sorting findings.
+  order    map[string]int
+  findings []Finding
+}
+
+// location is where a rule comes from.
+type location struct {
+  file string
+  line int
+}
+
+// locate returns the location of a rule from its source, "FILE:LINE".
+func locate(rule *policy.Rule) location {
+  i := strings.LastIndexByte(rule.Source, ':')
+  if i < 0 {
+    return location{rule.Source, 0}
+  }
+  line, _ := strconv.Atoi(rule.Source[i+1:])
+  return location{rule.Source[:i], line}
+}
+
+// from describes loc as seen from a rule at at: the line alone in the same
+// file.
+func (loc location) from(at location) string {
+  if loc.file == at.file {
+    return fmt.Sprintf("line %d", loc.line)
+  }
+  return fmt.Sprintf("%s:%d", loc.file, loc.line)
+}
+
+func (l *linter) report(loc location, severity, format string, args ...interface{}) {
+  l.findings = append(l.findings, Finding{loc.file, loc.line, severity, fmt.Sprintf(format, args...)})
+}
+
+// checkRule compares a rule with the earlier ones. The first matching rule
+// wins, so a rule allowing nothing more than an earlier one is of no use, and
+// its options never apply.
+func (l *linter) checkRule(earlierRules []*policy.Rule, rule *policy.Rule) {
+  loc := locate(rule)
+  if rule.Schedule != nil && rule.Schedule.Expired(time.Now()) {
+    l.report(loc, Warning, "expired at %s", rule.Schedule.Until.Format(time.RFC3339))
+  }
+  for _, earlier := range earlierRules {
+    if earlier.Path != rule.Path || (rule.Path == "" && earlier.Name != rule.Name) {
+      continue
+    }
+    same := earlier.AnyArgs == rule.AnyArgs && equal(earlier.Args, rule.Args)
+    // An earlier rule forbidding some arguments, or applying only some of
+    // the time, leaves the rest to later ones.
+    constrained := len(earlier.Forbid) > 0 || earlier.MaxArgs > 0 || earlier.Schedule != nil
+    switch {
+    case same && equal(earlier.Options, rule.Options):
+      l.report(loc, Warning, "duplicate of the rule on %s", locate(earlier).from(loc))
+      return
+    case constrained:
+    case same || earlier.AnyArgs && hasPrefix(rule.Args, earlier.Args):
+      l.report(loc, Warning, "shadowed by the rule on %s", locate(earlier).from(loc))
+      return
+    }
+  }
+}
+
+// checkFound checks that the program of a rule was found. A rule for a
+// program that is not found allows nothing, or denies nothing, which is
+// worse.
+func (l *linter) checkFound(rule *policy.Rule) bool {
+  if rule.Path != "" {
+    return true
+  }
+  if l.cfg.Chroot != "" {
+    l.report(locate(rule), Warning, "%s: not found outside of the jail", rule.Name)
+  } else {
+    l.report(locate(rule), Error, "%s: %v", rule.Name, policy.ErrNotFound)
+  }
+  return false
+}
+
+// checkDeny reports deny rules that match none of the commands allowed for
+// their program, which are likely meant to match differently.
+func (l *linter) checkDeny(rule *policy.Rule) {
+  if !l.checkFound(rule) {
+    return
+  }
+  allowed := false
+  for _, r := range l.cfg.Policy.Rules {
+    if r.Path != rule.Path {
+      continue
+    }
+    allowed = true
+    if r.AnyArgs || r.Patterns && anyPattern(r.Args) || rule.Match(r.Path, r.Args) {
+      return
+    }
+  }
+  if allowed {
+    l.report(locate(rule), Warning, "matches none of the commands allowed for %s", rule.Path)
+  } else {
+    l.report(locate(rule), Warning, "no rule allows %s, so this deny rule never matches", rule.Path)
+  }
+}
+
+func anyPattern(args []string) bool {
+  for _, arg := range args {
+    if policy.IsPattern(arg) {
+      return true
+    }
+  }
+  return false
+}
+
+// checkPatterns reports arguments that look like glob patterns in rules
+// without the @patterns option, which only match themselves.
+func (l *linter) checkPatterns(rule *policy.Rule) {
+  if rule.Patterns {
+    return
+  }
+  for _, arg := range rule.Args {
+    if strings.ContainsAny(arg, "*?[") {
+      l.report(locate(rule), Warning, "%q only matches itself; add @patterns to match it as a pattern", arg)
+    }
+  }
+}
+
+// checkProgram checks that the program of a rule exists and cannot be
+// replaced by anyone but root.
+func (l *linter) checkProgram(rule *policy.Rule) {
+  if !l.checkFound(rule) {
+    return
+  }
+  loc := locate(rule)
+  paths := []string{rule.Path}
+  if target, err := filepath.EvalSymlinks(rule.Path); err == nil && target != rule.Path {
+    paths = append(paths, target)
+  }
+  for _, path := range paths {
+    if info, err := os.Stat(path); err == nil && info.Mode()&0002 != 0 {
+      l.report(loc, Error, "%s is world-writable", path)
+    }
+    for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+      info, err := os.Stat(dir)
+      if err == nil && info.Mode()&0002 != 0 {
+        if info.Mode()&os.ModeSticky != 0 {
+          l.report(loc, Warning, "%s is in %s, which is world-writable", path, dir)
+        } else {
+          l.report(loc, Error, "%s is in %s, which is world-writable", path, dir)
+        }
+      }
+      if dir == "/" {
+        break
+      }
+    }
+  }
+}
+
+// checkDangerous reports rules allowing programs that run arbitrary code.
+// Programs that run commands are harmless if they may not start any.
+func (l *linter) checkDangerous(rule *policy.Rule) {
+  loc := locate(rule)
+  name := filepath.Base(rule.Name)
+  noExec := contains(l.cfg.Seccomp, seccomp.NoExec) || contains(rule.Seccomp, seccomp.NoExec)
+  switch {
+  case matches(shells, name):
+    l.reportCode(loc, rule, "%s is a shell", name)
+  case matches(interpreters, name):
+    l.reportCode(loc, rule, "%s is an interpreter", name)
+  case noExec:
+  case contains(runners, name):
+    l.reportCode(loc, rule, "%s runs the command given in its arguments", name)
+  case name == "find":
+    l.checkFind(loc, rule)
+  case contains(escapes, name) && !rule.NoEscape:
+    l.report(loc, Warning, "%s can start a shell; add @noescape", name)
+  }
+}
+
+// checkFind reports rules for find allowing an option that runs commands, as
+// an argument, through a pattern or among any arguments, unless @forbid
+// forbids it.
+func (l *linter) checkFind(loc location, rule *policy.Rule) {
+  var allowed []string
+  for _, opt := range findExec {
+    if rule.Forbids(opt) {
+      continue
+    }
+    for i, arg := range rule.Args {
+      if !rule.MatchArg(i, opt) {
+        continue
+      }
+      if arg == opt {
+        l.report(loc, Error, "find %s runs commands", opt)
+      } else {
+        l.report(loc, Error, "find %s allows %s, which runs commands", arg, opt)
+      }
+      return
+    }
+    if rule.AnyArgs {
+      allowed = append(allowed, opt)
+    }
+  }
+  if len(allowed) > 0 {
+    l.report(loc, Error, "find with any arguments allows %s, which run commands; add @forbid", strings.Join(allowed, ", "))
+  }
+}
+
+// reportCode reports a rule for a program that runs arbitrary code, which is
+// an error unless its arguments are fixed.
+func (l *linter) reportCode(loc location, rule *policy.Rule, format string, args ...interface{}) {
+  if rule.AnyArgs {
+    l.report(loc, Error, format+" and may run any code", args...)
+  } else {
+    l.report(loc, Warning, format+"; make sure its arguments cannot run other code", args...)
+  }
+}
+
+// matches reports whether name is in list, allowing version suffixes such as
+// those of python3 or perl5.36.
+func matches(list []string, name string) bool {
+  name = strings.TrimRight(name, "0123456789.")
+  return contains(list, name)
+}
+
+func equal(a, b []string) bool {
+  return len(a) == len(b) && hasPrefix(a, b)
+}
+
+func hasPrefix(list, prefix []string) bool {
+  if len(list) < len(prefix) {
+    return false
+  }
+  for i, s := range prefix {
+    if list[i] != s {
+      return false
+    }
+  }
+  return true
+}
+
+func contains(list []string, s string) bool {
+  for _, x := range list {
+    if x == s {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,145 @@
+package lint
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "strings"
+  "testing"
+)
+
+func TestLint(t *testing.T) {
+  const config = `# comment
+sh -c true
+sh -c true
+sh -c *
+sh -c ls
+@nosuch
+no-such-program-for-lish *
+env *
+find . -exec rm {} ;
+less *
+ls * @valid-until=2000-01-01
+!no-such-program-for-lish
+!dd
+date +%s
+!date -u
+!ls /etc
+echo *.txt
+echo ~[0-9]+ *.txt @patterns
+`
+  findings, err := Lint(strings.NewReader(config), "test")
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := []struct {
+    line     int
+    severity string
+    message  string
+  }{
+    {2, Warning, "sh is a shell"},
+    {3, Warning, "duplicate of the rule on line 2"},
+    {4, Error, "sh is a shell and may run any code"},
+    {5, Warning, "shadowed by the rule on line 4"},
+    {5, Warning, "sh is a shell"},
+    {6, Error, "unknown directive"},
+    {7, Error, "not found"},
+    {8, Error, "env runs the command"},
+    {9, Error, "find -exec runs commands"},
+    {10, Warning, "add @noescape"},
+    {11, Warning, "expired at 2000-01-02"},
+    {12, Error, "no-such-program-for-lish: executable not found"},
+    {13, Warning, "so this deny rule never matches"},
+    {15, Warning, "matches none of the commands allowed for"},
+    {17, Warning, `"*.txt" only matches itself; add @patterns`},
+  }
+  got := map[int][]Finding{}
+  for _, f := range findings {
+    if f.File != "test" {
+      t.Errorf("finding %v in file %q, want test", &f, f.File)
+    }
+    got[f.Line] = append(got[f.Line], f)
+  }
+  for _, w := range want {
+    found := false
+    for _, f := range got[w.line] {
+      if f.Severity == w.severity && strings.Contains(f.Message, w.message) {
+        found = true
+      }
+    }
+    if !found {
+      t.Errorf("no %s containing %q on line %d in %v", w.severity, w.message, w.line, got[w.line])
+    }
+  }
+}
+
+func TestLintNoExec(t *testing.T) {
+  findings, err := Lint(strings.NewReader("@seccomp no-exec\nenv *\nfind *\n"), "test")
+  if err != nil || len(findings) != 0 {
+    t.Errorf("Lint => (%v, %v), want no findings with no-exec", findings, err)
+  }
+}
+
+func TestLintFind(t *testing.T) {
+  for _, tt := range []struct {
+    rule, message string
+  }{
+    {"find *", "find with any arguments allows -exec, -execdir, -ok, -okdir"},
+    {"find * @forbid=-exec", "allows -execdir, -ok, -okdir"},
+    {"find . -e* ls @patterns", "find -e* allows -exec"},
+    {"find . ~-ok.* ls @patterns", "find ~-ok.* allows -ok"},
+    {"find * @forbid=-exec,-execdir,-ok,-okdir", ""},
+    {"find . ~-(exec|ok).* ls @patterns @forbid=-exec*,-ok*", ""},
+    {"find . -name *.go @patterns", ""},
+  } {
+    findings, err := Lint(strings.NewReader(tt.rule+"\n"), "test")
+    if err != nil {
+      t.Fatal(err)
+    }
+    switch {
+    case tt.message == "" && len(findings) != 0:
+      t.Errorf("Lint(%q) => %v, want no findings", tt.rule, findings)
+    case tt.message != "" && (len(findings) != 1 || findings[0].Severity != Error ||
+      !strings.Contains(findings[0].Message, tt.message)):
+      t.Errorf("Lint(%q) => %v, want an error containing %q", tt.rule, findings, tt.message)
+    }
+  }
+}
+
+func TestLintInclude(t *testing.T) {
+  dir, err := ioutil.TempDir("", "lint")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  common, main := filepath.Join(dir, "common"), filepath.Join(dir, "main")
+  if err := ioutil.WriteFile(common, []byte("sh -c *\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  if err := ioutil.WriteFile(main, []byte("@include common\nsh -c *\n"), 0644); err != nil {
+    t.Fatal(err)
+  }
+  // Included files are found relative to the linted one, wherever lint runs.
+  findings, err := File(main)
+  if err != nil {
+    t.Fatal(err)
+  }
+  want := []Finding{
+    {main, 2, Warning, "duplicate of the rule on " + common + ":1"},
+    {common, 1, Error, "sh is a shell and may run any code"},
+  }
+  for _, w := range want {
+    found := false
+    for _, f := range findings {
+      found = found || f == w
+    }
+    if !found {
+      t.Errorf("no finding %v in %v", &w, findings)
+    }
+  }
+  for _, f := range findings {
+    if f.File == main && f.Line == 1 {
+      t.Errorf("finding %v, want @include to be resolved", &f)
+    }
+  }
+}
@@ -0,0 +1,222 @@
+package policy
+
+import (
+  "errors"
+  "fmt"
+  "regexp"
+  "strings"
+)
+
+// Alias is a named command with typed parameters, such as
+// "logs <since:duration>", that expands to a fixed command line in which the
+// parameters are substituted, such as "journalctl --since=-{since}". It
+// comes with a rule allowing exactly its expansions, so that users may run
+// the command without being allowed the program otherwise.
+type Alias struct {
+  Name   string
+  Params []Param
+  // Template is the command line, with parameters written as "{name}".
+  Template []string
+  // Rule allows the expansions, and holds the rule options of the alias.
+  Rule *Rule
+}
+
+// Param is a parameter of an alias. Its Type is one of paramTypes, or a list
+// of choices such as "nginx|apache".
+type Param struct {
+  Name, Type string
+  // expr matches valid values, and re matches them alone.
+  expr string
+  re   *regexp.Regexp
+}
+
+// paramTypes maps the names of parameter types to regular expressions
+// matching their values. None of them lets a value pass for an option.
+var paramTypes = map[string]string{
+  "int":      `[0-9]+`,
+  "duration": `(?:[0-9]+[smhdw])+`,
+  "date":     `[0-9]{4}-[0-9]{2}-[0-9]{2}`,
+  "word":     `[A-Za-z0-9_][A-Za-z0-9_.:@+-]*`,
+}
+
+// reservedNames are builtins, which cannot be aliases.
+var reservedNames = []string{"cd", "exit"}
+
+var (
+  paramRe       = regexp.MustCompile(`^<([A-Za-z_][A-Za-z0-9_]*):([^>]+)>$`)
+  placeholderRe = regexp.MustCompile(`\{([^{}]*)\}`)
+  aliasNameRe   = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+)
+
+// ParseAlias builds an Alias from its definition:
+//
+//	NAME [<PARAM:TYPE>...] = PROGRAM [ARG...] [@OPTION...]
+//
+// Options are those of rules. As with ParseRule, the alias is returned with
+// ErrNotFound if its program cannot be found.
+func ParseAlias(fields []string) (*Alias, error) {
+  eq := -1
+  for i, field := range fields {
+    if field == "=" {
+      eq = i
+      break
+    }
+  }
+  if eq < 1 || eq == len(fields)-1 {
+    return nil, errors.New("want NAME [<PARAM:TYPE>...] = PROGRAM [ARG...]")
+  }
+  a := &Alias{Name: fields[0], Template: fields[eq+1:]}
+  if !aliasNameRe.MatchString(a.Name) || contains(reservedNames, a.Name) {
+    return nil, fmt.Errorf("invalid alias name %q", a.Name)
+  }
+  for _, field := range fields[1:eq] {
+    m := paramRe.FindStringSubmatch(field)
+    if m == nil {
+      return nil, fmt.Errorf("%s: invalid parameter %q, want <NAME:TYPE>", a.Name, field)
+    }
+    if a.param(m[1]) != nil {
+      return nil, fmt.Errorf("%s: duplicate parameter %s", a.Name, m[1])
+    }
+    re, err := paramType(m[2])
+    if err != nil {
+      return nil, fmt.Errorf("%s: %s: %v", a.Name, m[1], err)
+    }
+    a.Params = append(a.Params, Param{m[1], m[2], re, regexp.MustCompile("^(?:" + re + ")$")})
+  }
+  if strings.ContainsAny(a.Template[0], "{}") {
+    return nil, fmt.Errorf("%s: the program cannot be a parameter", a.Name)
+  }
+  ruleFields := []string{a.Template[0]}
+  used := map[string]bool{}
+  for _, word := range a.Template[1:] {
+    if _, _, ok := splitOption(word); ok {
+      ruleFields = append(ruleFields, word)
+      continue
+    }
+    arg, err := a.pattern(word, used)
+    if err != nil {
+      return nil, err
+    }
+    ruleFields = append(ruleFields, arg)
+  }
+  for _, p := range a.Params {
+    if !used[p.Name] {
+      return nil, fmt.Errorf("%s: parameter %s is not used", a.Name, p.Name)
+    }
+  }
+  // The words of the template have been turned into patterns.
+  if !contains(ruleFields, "@patterns") {
+    ruleFields = append(ruleFields, "@patterns")
+  }
+  rule, err := ParseRule(ruleFields)
+  if err != nil && err != ErrNotFound {
+    return nil, fmt.Errorf("%s: %v", a.Name, err)
+  }
+  if rule.Deny {
+    return nil, fmt.Errorf("%s: aliases cannot deny", a.Name)
+  }
+  a.Rule = rule
+  return a, err
+}
+
+func paramType(typ string) (string, error) {
+  if re, ok := paramTypes[typ]; ok {
+    return re, nil
+  }
+  if !strings.Contains(typ, "|") {
+    return "", fmt.Errorf("unknown type %q", typ)
+  }
+  var choices []string
+  for _, choice := range strings.Split(typ, "|") {
+    if choice == "" || strings.HasPrefix(choice, "-") {
+      return "", fmt.Errorf("invalid choice %q", choice)
+    }
+    choices = append(choices, regexp.QuoteMeta(choice))
+  }
+  return strings.Join(choices, "|"), nil
+}
+
+func (a *Alias) param(name string) *Param {
+  for i := range a.Params {
+    if a.Params[i].Name == name {
+      return &a.Params[i]
+    }
+  }
+  return nil
+}
+
+// pattern turns a word of the template into an argument of the rule of the
+// alias: a glob matching just the word, or a regular expression matching the
+// word with any valid values in place of its parameters. The parameters are
+// marked as used.
+func (a *Alias) pattern(word string, used map[string]bool) (string, error) {
+  matches := placeholderRe.FindAllStringSubmatchIndex(word, -1)
+  if matches == nil {
+    if strings.ContainsAny(word, "{}") {
+      return "", fmt.Errorf("%s: unbalanced braces in %q", a.Name, word)
+    }
+    return escapeGlob(word), nil
+  }
+  var b strings.Builder
+  b.WriteString("~")
+  last := 0
+  for _, m := range matches {
+    literal, name := word[last:m[0]], word[m[2]:m[3]]
+    p := a.param(name)
+    if p == nil {
+      return "", fmt.Errorf("%s: unknown parameter {%s}", a.Name, name)
+    }
+    used[name] = true
+    b.WriteString(regexp.QuoteMeta(literal))
+    b.WriteString("(?:" + p.expr + ")")
+    last = m[1]
+  }
+  if strings.ContainsAny(word[last:], "{}") {
+    return "", fmt.Errorf("%s: unbalanced braces in %q", a.Name, word)
+  }
+  b.WriteString(regexp.QuoteMeta(word[last:]))
+  return b.String(), nil
+}
+
+// Expand checks the arguments given to the alias against its parameters and
+// returns the command line with them substituted.
+func (a *Alias) Expand(args []string) ([]string, error) {
+  if len(args) != len(a.Params) {
+    return nil, fmt.Errorf("usage: %s", a.Usage())
+  }
+  values := map[string]string{}
+  for i, p := range a.Params {
+    if !p.re.MatchString(args[i]) {
+      return nil, fmt.Errorf("%s: %q is not a valid %s", p.Name, args[i], p.Type)
+    }
+    values[p.Name] = args[i]
+  }
+  var argv []string
+  for _, word := range a.Template {
+    if _, _, ok := splitOption(word); ok {
+      continue
+    }
+    argv = append(argv, placeholderRe.ReplaceAllStringFunc(word, func(m string) string {
+      return values[m[1:len(m)-1]]
+    }))
+  }
+  return argv, nil
+}
+
+// Usage returns the alias with its parameters, as in "logs <since:duration>".
+func (a *Alias) Usage() string {
+  fields := []string{a.Name}
+  for _, p := range a.Params {
+    fields = append(fields, "<"+p.Name+":"+p.Type+">")
+  }
+  return strings.Join(fields, " ")
+}
+
+func contains(list []string, s string) bool {
+  for _, x := range list {
+    if x == s {
+      return true
+    }
+  }
+  return false
+}
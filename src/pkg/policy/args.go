@@ -0,0 +1,93 @@
+package policy
+
+import (
+  "fmt"
+  "path"
+  "regexp"
+  "strings"
+)
+
+// pattern matches an argument of a command against one of a rule. Arguments
+// of rules match just themselves, unless the rule has the @patterns option:
+// then they are glob patterns as in path.Match, so that "*.service" matches
+// "sshd.service", or regular expressions matching the whole argument if they
+// start with "~", as in "~[0-9]+". Without any special characters, a pattern
+// matches just itself; a backslash takes away the special meaning of the next
+// character, as in "\~" or "\*".
+type pattern struct {
+  glob string
+  re   *regexp.Regexp
+}
+
+func compilePattern(arg string) (pattern, error) {
+  if strings.HasPrefix(arg, "~") {
+    re, err := regexp.Compile("^(?:" + arg[1:] + ")$")
+    if err != nil {
+      return pattern{}, fmt.Errorf("invalid regular expression %q: %v", arg[1:], err)
+    }
+    return pattern{re: re}, nil
+  }
+  if _, err := path.Match(arg, ""); err != nil {
+    return pattern{}, fmt.Errorf("invalid pattern %q: %v", arg, err)
+  }
+  return pattern{glob: arg}, nil
+}
+
+// literalPattern returns a pattern matching just arg.
+func literalPattern(arg string) pattern {
+  return pattern{glob: escapeGlob(arg)}
+}
+
+// escapeGlob returns a pattern matching just s.
+func escapeGlob(s string) string {
+  var b strings.Builder
+  for i, c := range s {
+    if strings.ContainsRune(`*?[]\`, c) || (i == 0 && c == '~') {
+      b.WriteByte('\\')
+    }
+    b.WriteRune(c)
+  }
+  return b.String()
+}
+
+// IsPattern reports whether the argument of a rule with the @patterns option
+// matches anything but itself.
+func IsPattern(arg string) bool {
+  return strings.HasPrefix(arg, "~") || strings.ContainsAny(arg, `*?[\`)
+}
+
+func (p pattern) match(arg string) bool {
+  if p.re != nil {
+    return p.re.MatchString(arg)
+  }
+  ok, _ := path.Match(p.glob, arg)
+  return ok
+}
+
+// forbidden reports whether arg is excluded by the pattern of a forbidden
+// argument, see the @forbid rule option. A long option such as
+// "--to-command" is also found with a value, as in "--to-command=sh", and when
+// abbreviated, as in "--to-com", which getopt_long accepts. A short option
+// such as "-I" is also found in a group of options, as in "-xI".
+func forbidden(forbid, arg string) bool {
+  if ok, _ := path.Match(forbid, arg); ok {
+    return true
+  }
+  switch {
+  case strings.HasPrefix(forbid, "--"):
+    if !strings.HasPrefix(arg, "--") || arg == "--" {
+      return false
+    }
+    name := arg
+    if i := strings.IndexByte(arg, '='); i >= 0 {
+      name = arg[:i]
+    }
+    if ok, _ := path.Match(forbid, name); ok {
+      return true
+    }
+    return len(name) > 2 && strings.HasPrefix(forbid, name)
+  case len(forbid) == 2 && forbid[0] == '-' && forbid[1] != '-':
+    return len(arg) > 2 && arg[0] == '-' && arg[1] != '-' && strings.IndexByte(arg[1:], forbid[1]) >= 0
+  }
+  return false
+}
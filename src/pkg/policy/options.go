@@ -0,0 +1,258 @@
+package policy
+
+import (
+  "errors"
+  "fmt"
+  "path"
+  "strconv"
+  "strings"
+  "time"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/limits"
+  "github.com/m9rco/phoenix-shell/src/pkg/sandbox"
+  "github.com/m9rco/phoenix-shell/src/pkg/seccomp"
+)
+
+// ruleOptions maps the names of rule options to the functions applying them to
+// a rule. Options follow the arguments of a rule as "@name=value":
+//
+//	@path=N[,N...]  the N-th operand, and every operand past the highest N,
+//	                is a file path that must lie within the allowed
+//	                directories
+//	@path=*         every operand, and the value of every option, is such a
+//	                path
+//	@limit=NAME=VALUE[,NAME=VALUE...]
+//	                resource limits of the command, see limits.Names; they
+//	                override the limits of the user
+//	@seccomp=PROFILE[,PROFILE...]
+//	                seccomp profiles of the command, see seccomp.Profiles,
+//	                in addition to those of the user
+//	@noescape       keep the command from starting a shell: LESSSECURE and
+//	                MORESECURE are set, SHELL is always this shell and vi is
+//	                run with -Z; add @seccomp=no-exec to deny starting any
+//	                program
+//	@forbid=ARG[,ARG...]
+//	                arguments the command may not have anywhere; they are
+//	                glob patterns as in path.Match. Long options are also
+//	                forbidden with a value or abbreviated, short ones also
+//	                in groups such as -xI
+//	@patterns       the arguments of the rule are globs such as *.service, or
+//	                regular expressions such as ~[0-9]+, see pattern;
+//	                without it they match just themselves
+//	@maxargs=N      the command may have at most N arguments, including the
+//	                fixed ones
+//	@caps=CAP[,CAP...]
+//	                capabilities the command keeps when privileges are
+//	                dropped, such as net_raw or CAP_NET_RAW; all others are
+//	                dropped
+//	@confirm        the user must confirm the command before it runs
+//	@justify        the user must give a reason for running the command,
+//	                which is audited
+//	@valid-from=TIME
+//	@valid-until=TIME
+//	                the rule applies from, or until, TIME, given as
+//	                YYYY-MM-DD, YYYY-MM-DDTHH:MM or in RFC 3339; a date
+//	                alone for @valid-until includes that day
+//	@window=DAYS/HH:MM-HH:MM[,...]
+//	                the rule only applies within one of these weekly
+//	                windows, such as mon-fri/09:00-18:00 or sat+sun; either
+//	                part may be left out, and a window ending before it
+//	                starts ends on the next day
+//	@tz=ZONE        the time zone of the times above, such as Europe/Berlin;
+//	                the local one by default
+var ruleOptions = map[string]func(r *Rule, value string) error{
+  "path":        parsePathOption,
+  "limit":       parseLimitOption,
+  "seccomp":     parseSeccompOption,
+  "noescape":    parseNoEscapeOption,
+  "caps":        parseCapsOption,
+  "forbid":      parseForbidOption,
+  "patterns":    parsePatternsOption,
+  "maxargs":     parseMaxArgsOption,
+  "confirm":     parseConfirmOption,
+  "justify":     parseJustifyOption,
+  "valid-from":  parseValidFromOption,
+  "valid-until": parseValidUntilOption,
+  "window":      parseWindowOption,
+  "tz":          parseTZOption,
+}
+
+// splitOption splits a rule field into the name and value of an option. It
+// reports false for fields that are not options, so that arguments such as
+// "@8.8.8.8" can still be used in rules.
+func splitOption(field string) (name, value string, ok bool) {
+  if !strings.HasPrefix(field, "@") {
+    return "", "", false
+  }
+  name = field[1:]
+  if i := strings.IndexByte(name, '='); i >= 0 {
+    name, value = name[:i], name[i+1:]
+  }
+  _, ok = ruleOptions[name]
+  return name, value, ok
+}
+
+func parsePathOption(r *Rule, value string) error {
+  if value == Wildcard {
+    r.AllPaths = true
+    return nil
+  }
+  if value == "" {
+    return errors.New("missing operand positions")
+  }
+  for _, s := range strings.Split(value, ",") {
+    n, err := strconv.Atoi(s)
+    if err != nil || n < 1 {
+      return fmt.Errorf("invalid operand position %q", s)
+    }
+    r.Paths = append(r.Paths, n)
+  }
+  return nil
+}
+
+func parseLimitOption(r *Rule, value string) error {
+  if value == "" {
+    return errors.New("missing limits")
+  }
+  if r.Limits == nil {
+    r.Limits = limits.Limits{}
+  }
+  for _, setting := range strings.Split(value, ",") {
+    if err := r.Limits.Set(setting); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+func parseSeccompOption(r *Rule, value string) error {
+  if value == "" {
+    return errors.New("missing profiles")
+  }
+  for _, name := range strings.Split(value, ",") {
+    if _, ok := seccomp.Profiles[name]; !ok {
+      return fmt.Errorf("unknown seccomp profile %q", name)
+    }
+    r.Seccomp = append(r.Seccomp, name)
+  }
+  return nil
+}
+
+func parseNoEscapeOption(r *Rule, value string) error {
+  if value != "" {
+    return errors.New("takes no value")
+  }
+  r.NoEscape = true
+  return nil
+}
+
+func parseCapsOption(r *Rule, value string) error {
+  if value == "" {
+    return errors.New("missing capabilities")
+  }
+  for _, name := range strings.Split(value, ",") {
+    c := strings.TrimPrefix(strings.ToLower(name), "cap_")
+    if _, ok := sandbox.Capabilities[c]; !ok {
+      return fmt.Errorf("unknown capability %q", name)
+    }
+    r.Caps = append(r.Caps, c)
+  }
+  return nil
+}
+
+func parseForbidOption(r *Rule, value string) error {
+  if value == "" {
+    return errors.New("missing arguments")
+  }
+  for _, arg := range strings.Split(value, ",") {
+    if _, err := path.Match(arg, ""); err != nil {
+      return fmt.Errorf("invalid pattern %q: %v", arg, err)
+    }
+    r.Forbid = append(r.Forbid, arg)
+  }
+  return nil
+}
+
+func parsePatternsOption(r *Rule, value string) error {
+  if value != "" {
+    return errors.New("takes no value")
+  }
+  r.Patterns = true
+  return nil
+}
+
+func parseMaxArgsOption(r *Rule, value string) error {
+  n, err := strconv.Atoi(value)
+  if err != nil || n < 1 {
+    return fmt.Errorf("invalid number of arguments %q", value)
+  }
+  r.MaxArgs = n
+  return nil
+}
+
+func parseConfirmOption(r *Rule, value string) error {
+  if value != "" {
+    return errors.New("takes no value")
+  }
+  r.Confirm = true
+  return nil
+}
+
+func parseJustifyOption(r *Rule, value string) error {
+  if value != "" {
+    return errors.New("takes no value")
+  }
+  r.Justify = true
+  return nil
+}
+
+// schedule returns the schedule of the rule, adding one if needed.
+func (r *Rule) schedule() *Schedule {
+  if r.Schedule == nil {
+    r.Schedule = &Schedule{}
+  }
+  return r.Schedule
+}
+
+func parseValidFromOption(r *Rule, value string) error {
+  if value == "" {
+    return errors.New("missing time")
+  }
+  r.schedule().from = value
+  return nil
+}
+
+func parseValidUntilOption(r *Rule, value string) error {
+  if value == "" {
+    return errors.New("missing time")
+  }
+  r.schedule().until = value
+  return nil
+}
+
+func parseWindowOption(r *Rule, value string) error {
+  if value == "" {
+    return errors.New("missing window")
+  }
+  s := r.schedule()
+  for _, text := range strings.Split(value, ",") {
+    w, err := parseWindow(text)
+    if err != nil {
+      return err
+    }
+    s.Windows = append(s.Windows, w)
+  }
+  return nil
+}
+
+func parseTZOption(r *Rule, value string) error {
+  if value == "" {
+    return errors.New("missing time zone")
+  }
+  loc, err := time.LoadLocation(value)
+  if err != nil {
+    return fmt.Errorf("unknown time zone %q", value)
+  }
+  r.schedule().Location = loc
+  return nil
+}
@@ -0,0 +1,100 @@
+package policy
+
+import (
+  "fmt"
+  "strings"
+)
+
+// CheckPaths checks the arguments that the rule marks as file paths against
+// the allowed directories. args are all arguments of the command, including
+// those fixed by the rule.
+func (r *Rule) CheckPaths(args []string, roots Roots) error {
+  if len(roots) == 0 {
+    return nil
+  }
+  for _, path := range r.pathArgs(args) {
+    if _, err := roots.Check(path); err != nil {
+      return fmt.Errorf("%s: %v", path, err)
+    }
+  }
+  return nil
+}
+
+// pathArgs returns the arguments that are file paths. Operands are the
+// arguments following the fixed ones that are not options, where everything
+// after "--" is an operand and "-" stands for standard input. The operands at
+// the positions in Paths are paths, and so is every operand past the highest
+// of them, since a program taking files there takes them all the way. With
+// AllPaths, every operand is a path, and so are the values of options, since
+// they may just as well name files: the value of "--name=value", and the value
+// of a short option written together with it, as in "-f/etc/passwd" or, after
+// other options, "-rf/etc/passwd". As "-rf" alone gives no clue where the
+// value starts, each suffix that follows only letters and digits is taken as
+// a value.
+func (r *Rule) pathArgs(args []string) []string {
+  if len(args) < len(r.Args) {
+    return nil
+  }
+  var operands, values []string
+  endOfOptions := false
+  for _, arg := range args[len(r.Args):] {
+    switch {
+    case endOfOptions:
+      operands = append(operands, arg)
+    case arg == "--":
+      endOfOptions = true
+    case arg == "-":
+      operands = append(operands, "")
+    case strings.HasPrefix(arg, "--") && strings.Contains(arg, "="):
+      values = append(values, arg[strings.IndexByte(arg, '=')+1:])
+    case strings.HasPrefix(arg, "--"):
+    case strings.HasPrefix(arg, "-"):
+      for i := 2; i < len(arg); i++ {
+        values = append(values, arg[i:])
+        if !isAlnum(arg[i]) {
+          break
+        }
+      }
+    default:
+      operands = append(operands, arg)
+    }
+  }
+
+  var paths []string
+  if r.AllPaths {
+    paths = append(operands, values...)
+  } else {
+    last := 0
+    for _, n := range r.Paths {
+      if n > last {
+        last = n
+      }
+    }
+    for i, operand := range operands {
+      if last > 0 && i+1 >= last || containsInt(r.Paths, i+1) {
+        paths = append(paths, operand)
+      }
+    }
+  }
+  // Drop the placeholders for standard input and empty values.
+  filtered := paths[:0]
+  for _, path := range paths {
+    if path != "" {
+      filtered = append(filtered, path)
+    }
+  }
+  return filtered
+}
+
+func containsInt(list []int, n int) bool {
+  for _, x := range list {
+    if x == n {
+      return true
+    }
+  }
+  return false
+}
+
+func isAlnum(c byte) bool {
+  return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
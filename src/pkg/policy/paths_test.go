@@ -0,0 +1,93 @@
+package policy
+
+import (
+  "io/ioutil"
+  "os"
+  "reflect"
+  "testing"
+)
+
+var pathArgs = []struct {
+  rule []string
+  args []string
+  want []string
+}{
+  {[]string{"/bin/cat", "*", "@path=*"}, []string{"-n", "a", "-", "b"}, []string{"a", "b"}},
+  {[]string{"/bin/cat", "*", "@path=*"}, []string{"--", "-n"}, []string{"-n"}},
+  {[]string{"/bin/grep", "*", "@path=2"}, []string{"-i", "pattern", "file", "more"}, []string{"file", "more"}},
+  {[]string{"/bin/cat", "*", "@path=1"}, []string{"f", "/etc/hostname"}, []string{"f", "/etc/hostname"}},
+  {[]string{"/bin/cp", "*", "@path=1,3"}, []string{"a", "b", "c", "d"}, []string{"a", "c", "d"}},
+  {[]string{"/bin/grep", "*", "@path=2,3"}, []string{"pattern"}, nil},
+  {[]string{"/bin/tail", "-n", "20", "*", "@path=1"}, []string{"-n", "20", "log"}, []string{"log"}},
+  {[]string{"/bin/sort", "*", "@path=*"}, []string{"--output=/etc/passwd", "in"}, []string{"in", "/etc/passwd"}},
+  {[]string{"/bin/grep", "*", "@path=*"}, []string{"-f/etc/shadow", "x"}, []string{"x", "/etc/shadow"}},
+  {[]string{"/bin/grep", "*", "@path=*"}, []string{"-rf../x", "--count"}, []string{"f../x", "../x"}},
+  {[]string{"/bin/grep", "*", "@path=2"}, []string{"-f/etc/shadow", "x"}, nil},
+  {[]string{"/bin/cat", "*"}, []string{"/etc/shadow"}, nil},
+}
+
+func TestPathArgs(t *testing.T) {
+  for _, tt := range pathArgs {
+    r, err := ParseRule(tt.rule)
+    if err != nil {
+      t.Errorf("ParseRule(%q) => %v, want <nil>", tt.rule, err)
+      continue
+    }
+    if got := r.pathArgs(tt.args); !reflect.DeepEqual(got, tt.want) {
+      t.Errorf("rule %q: pathArgs(%q) => %q, want %q", tt.rule, tt.args, got, tt.want)
+    }
+  }
+}
+
+func TestCheckPaths(t *testing.T) {
+  dir, err := ioutil.TempDir("", "paths")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  // Relative paths are resolved in the current directory.
+  wd, err := os.Getwd()
+  if err != nil {
+    t.Fatal(err)
+  }
+  if err := os.Chdir(dir); err != nil {
+    t.Fatal(err)
+  }
+  defer os.Chdir(wd)
+  roots := Roots{dir}
+  for _, tt := range []struct {
+    rule []string
+    args []string
+    ok   bool
+  }{
+    {[]string{"/bin/cat", "*", "@path=1"}, []string{dir + "/f", dir + "/g"}, true},
+    {[]string{"/bin/cat", "*", "@path=1"}, []string{dir + "/f", "/etc/hostname"}, false},
+    {[]string{"/bin/grep", "*", "@path=*"}, []string{"-n", "-A3", "x", dir}, true},
+    {[]string{"/bin/grep", "*", "@path=*"}, []string{"-f/etc/shadow", dir}, false},
+    {[]string{"/bin/grep", "*", "@path=*"}, []string{"-if/etc/shadow", dir}, false},
+  } {
+    r, err := ParseRule(tt.rule)
+    if err != nil {
+      t.Errorf("ParseRule(%q) => %v, want <nil>", tt.rule, err)
+      continue
+    }
+    if err := r.CheckPaths(tt.args, roots); (err == nil) != tt.ok {
+      t.Errorf("rule %q: CheckPaths(%q) => %v, want ok %v", tt.rule, tt.args, err, tt.ok)
+    }
+  }
+}
+
+func TestPathOption(t *testing.T) {
+  r, err := ParseRule([]string{"/lish/test/dig", "@8.8.8.8", "*", "@path=1"})
+  if err != nil || len(r.Args) != 1 || r.Args[0] != "@8.8.8.8" {
+    t.Errorf("ParseRule => (%v, %v), want @8.8.8.8 kept as argument", r, err)
+  }
+  if s := r.String(); s != "/lish/test/dig @8.8.8.8 * @path=1" {
+    t.Errorf("String() => %q, want %q", s, "/lish/test/dig @8.8.8.8 * @path=1")
+  }
+  for _, opt := range []string{"@path", "@path=0", "@path=x"} {
+    if _, err := ParseRule([]string{"/bin/cat", "*", opt}); err == nil {
+      t.Errorf("ParseRule with %s => <nil>, want error", opt)
+    }
+  }
+}
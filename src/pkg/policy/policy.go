@@ -0,0 +1,436 @@
+// Package policy decides which commands a restricted user is allowed to
+// execute.
+package policy
+
+import (
+  "errors"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/limits"
+)
+
+// DefaultPath is the fixed search path used to resolve program names that do
+// not contain a slash, both in rules and in commands typed by the user.
+const DefaultPath = "/bin:/usr/bin:/sbin:/usr/sbin:/usr/local/bin:/usr/local/sbin"
+
+// Wildcard may be given as the last argument of a rule to allow any further
+// arguments.
+const Wildcard = "*"
+
+// DenyPrefix marks the program of a deny rule.
+const DenyPrefix = "!"
+
+var (
+  // ErrForbidden is returned by Policy.Check when no rule matches a command.
+  ErrForbidden = errors.New("command not allowed")
+  // ErrDenied is returned by Policy.Check when a deny rule matches.
+  ErrDenied = errors.New("command denied")
+  // ErrNotFound is returned when a program name cannot be found in
+  // DefaultPath.
+  ErrNotFound = errors.New("executable not found in " + DefaultPath)
+)
+
+// Rule allows a single program, either with exactly the given arguments or,
+// if AnyArgs is set, with any arguments starting with them. If Patterns is
+// set, the arguments of the rule are patterns, see pattern. Deny rules match
+// differently, see denies.
+type Rule struct {
+  // Deny makes the rule forbid the commands it matches, regardless of any
+  // other rules.
+  Deny bool
+  // Source tells where the rule was read from, such as "/etc/lishrc:3".
+  Source string
+  // Name is the program as written in the rule, Path its resolved form.
+  Name     string
+  Path     string
+  Args     []string
+  AnyArgs  bool
+  Patterns bool
+  // Forbid lists arguments the command may not have anywhere, see
+  // forbidden. If MaxArgs is not zero, the command may not have more
+  // arguments.
+  Forbid  []string
+  MaxArgs int
+  // Options holds the rule options as written, see ruleOptions.
+  Options []string
+
+  // Paths lists the 1-based positions of the operands that are file paths,
+  // counted among the arguments following Args. AllPaths marks every operand
+  // as a path.
+  Paths    []int
+  AllPaths bool
+
+  // Limits holds the resource limits of the command.
+  Limits limits.Limits
+  // Seccomp lists the seccomp profiles of the command.
+  Seccomp []string
+  // NoEscape enables the mitigations of shell escapes.
+  NoEscape bool
+  // Caps lists the capabilities the command keeps, see sandbox.Capabilities.
+  Caps []string
+  // Confirm and Justify make the user confirm the command, or give a reason
+  // for it, before it runs.
+  Confirm bool
+  Justify bool
+  // Schedule, if set, limits when the rule applies.
+  Schedule *Schedule
+
+  // patterns holds the compiled Args.
+  patterns []pattern
+}
+
+// ParseRule builds a Rule from a program and its optional arguments. Program
+// names without a slash are resolved against DefaultPath; if that fails, the
+// rule is returned with an empty Path, which matches nothing, together with
+// ErrNotFound. Arguments match just themselves, or are patterns with the
+// @patterns option, see pattern; a trailing Wildcard allows any further
+// arguments.
+// Fields of the form "@name=value" naming a known rule option are options
+// rather than arguments. A program prefixed with DenyPrefix makes a deny rule,
+// which takes no options but @patterns and matches any further arguments
+// anyway, see denies.
+func ParseRule(fields []string) (*Rule, error) {
+  if len(fields) == 0 {
+    return nil, errors.New("empty rule")
+  }
+  r := &Rule{Name: fields[0]}
+  if strings.HasPrefix(r.Name, DenyPrefix) {
+    r.Deny, r.Name = true, r.Name[len(DenyPrefix):]
+    if r.Name == "" {
+      return nil, errors.New("missing program after " + DenyPrefix)
+    }
+  }
+  resolveErr := r.Resolve()
+  if resolveErr != nil && resolveErr != ErrNotFound {
+    return nil, resolveErr
+  }
+  var args []string
+  for _, field := range fields[1:] {
+    name, value, ok := splitOption(field)
+    if !ok {
+      args = append(args, field)
+      continue
+    }
+    if r.Deny && name != "patterns" {
+      return nil, fmt.Errorf("%s: only @patterns is allowed in deny rules", fields[0])
+    }
+    if err := ruleOptions[name](r, value); err != nil {
+      return nil, fmt.Errorf("%s: @%s: %v", fields[0], name, err)
+    }
+    r.Options = append(r.Options, field)
+  }
+  if r.Schedule != nil {
+    if err := r.Schedule.compile(); err != nil {
+      return nil, fmt.Errorf("%s: %v", fields[0], err)
+    }
+  }
+  for i, arg := range args {
+    if arg == Wildcard {
+      if i != len(args)-1 {
+        return nil, fmt.Errorf("%s: '%s' must be the last argument", fields[0], Wildcard)
+      }
+      r.AnyArgs = true
+      break
+    }
+    p := literalPattern(arg)
+    if r.Patterns {
+      var err error
+      if p, err = compilePattern(arg); err != nil {
+        return nil, fmt.Errorf("%s: %v", fields[0], err)
+      }
+    }
+    r.Args = append(r.Args, arg)
+    r.patterns = append(r.patterns, p)
+  }
+  return r, resolveErr
+}
+
+// Resolve sets Path by resolving Name again, for use after the root directory
+// has changed. On failure Path is left empty.
+func (r *Rule) Resolve() error {
+  path, err := Resolve(r.Name)
+  r.Path = path
+  return err
+}
+
+// Match reports whether the rule allows running the program at path with the
+// given arguments. The path must already be resolved with Resolve.
+func (r *Rule) Match(path string, args []string) bool {
+  return r.match(path, args) == nil
+}
+
+// MatchArg reports whether the i-th argument of the rule matches arg.
+func (r *Rule) MatchArg(i int, arg string) bool {
+  return r.patterns[i].match(arg)
+}
+
+// Forbids reports whether the command may not have arg anywhere, see the
+// @forbid rule option.
+func (r *Rule) Forbids(arg string) bool {
+  for _, forbid := range r.Forbid {
+    if forbidden(forbid, arg) {
+      return true
+    }
+  }
+  return false
+}
+
+// errNoMatch is returned by Rule.match for commands a rule is not about.
+var errNoMatch = errors.New("no match")
+
+// match returns nil if the rule allows the command, errNoMatch if the rule
+// does not cover it at all, or an error saying which constraint of the rule
+// it violates.
+func (r *Rule) match(path string, args []string) error {
+  if r.Path == "" || path != r.Path {
+    return errNoMatch
+  }
+  if r.Deny {
+    if !r.denies(args) {
+      return errNoMatch
+    }
+    return nil
+  }
+  if len(args) < len(r.Args) || (!r.AnyArgs && len(args) != len(r.Args)) {
+    return errNoMatch
+  }
+  for i, p := range r.patterns {
+    if !p.match(args[i]) {
+      return errNoMatch
+    }
+  }
+  if r.MaxArgs > 0 && len(args) > r.MaxArgs {
+    return fmt.Errorf("more than %d arguments", r.MaxArgs)
+  }
+  for _, arg := range args {
+    if r.Forbids(arg) {
+      return fmt.Errorf("%s: argument not allowed", arg)
+    }
+  }
+  if r.Schedule != nil {
+    return r.Schedule.check(now())
+  }
+  return nil
+}
+
+// denies reports whether the arguments of a command running the program of
+// the deny rule r are denied: whatever other arguments there are, and in any
+// order, each argument of the rule must match one of them. A rule without
+// arguments thus denies the program altogether. Since a file can be named in
+// many ways, an argument is also matched as a cleaned path, with each of its
+// trailing components removed, and so is the value of "--name=value": denying
+// "/etc" denies "/etc/", "/etc/shadow" and "--file=/etc/shadow" too.
+func (r *Rule) denies(args []string) bool {
+  for _, p := range r.patterns {
+    found := false
+    for _, arg := range args {
+      if found = denyMatch(p, arg); found {
+        break
+      }
+    }
+    if !found {
+      return false
+    }
+  }
+  return true
+}
+
+func denyMatch(p pattern, arg string) bool {
+  if p.match(arg) {
+    return true
+  }
+  if strings.HasPrefix(arg, "--") {
+    if i := strings.IndexByte(arg, '='); i >= 0 {
+      arg = arg[i+1:]
+      if p.match(arg) {
+        return true
+      }
+    }
+  }
+  if !strings.Contains(arg, "/") {
+    return false
+  }
+  for name := filepath.Clean(arg); name != "/" && name != "."; name = filepath.Dir(name) {
+    if p.match(name) {
+      return true
+    }
+  }
+  return false
+}
+
+func (r *Rule) String() string {
+  path := r.Path
+  if path == "" {
+    path = r.Name
+  }
+  if r.Deny {
+    path = DenyPrefix + path
+  }
+  fields := append([]string{path}, r.Args...)
+  if r.AnyArgs {
+    fields = append(fields, Wildcard)
+  }
+  fields = append(fields, r.Options...)
+  return strings.Join(fields, " ")
+}
+
+// Policy is an ordered list of rules allowing commands, and a list of rules
+// denying them, which take precedence. Aliases stand for commands allowed by
+// their own rules among Rules. The zero value allows nothing.
+type Policy struct {
+  Rules   []*Rule
+  Deny    []*Rule
+  Aliases []*Alias
+}
+
+// Add appends a rule to the policy.
+func (p *Policy) Add(r *Rule) {
+  if r.Deny {
+    p.Deny = append(p.Deny, r)
+  } else {
+    p.Rules = append(p.Rules, r)
+  }
+}
+
+// AddAlias adds an alias and appends its rule to the policy. Aliases cannot
+// be redefined.
+func (p *Policy) AddAlias(a *Alias) error {
+  if p.Alias(a.Name) != nil {
+    return fmt.Errorf("alias %s already defined", a.Name)
+  }
+  p.Aliases = append(p.Aliases, a)
+  p.Add(a.Rule)
+  return nil
+}
+
+// Alias returns the named alias, or nil.
+func (p *Policy) Alias(name string) *Alias {
+  for _, a := range p.Aliases {
+    if a.Name == name {
+      return a
+    }
+  }
+  return nil
+}
+
+// Resolve resolves the programs of all rules again, for use after the root
+// directory has changed. Rules whose program is not found are kept, but match
+// nothing; the names of those allowing commands are returned.
+func (p *Policy) Resolve() []string {
+  var missing []string
+  for _, r := range p.Rules {
+    if err := r.Resolve(); err != nil {
+      missing = append(missing, r.Name)
+    }
+  }
+  for _, r := range p.Deny {
+    r.Resolve()
+  }
+  return missing
+}
+
+// Check resolves the program named by argv[0] and looks for a rule allowing
+// argv. It returns the first matching rule together with the resolved path of
+// the program. If a deny rule matches, it is returned with an error. If no
+// rule matches, the error says why the first rule covering the command
+// rejects it, or is ErrForbidden.
+func (p *Policy) Check(argv []string) (*Rule, string, error) {
+  path, deny, err := p.denied(argv)
+  if err != nil {
+    return deny, path, err
+  }
+  reason := ErrForbidden
+  for _, r := range p.Rules {
+    err := r.match(path, argv[1:])
+    if err == nil {
+      return r, path, nil
+    }
+    if err != errNoMatch && reason == ErrForbidden {
+      reason = err
+    }
+  }
+  return nil, path, reason
+}
+
+// CheckAlias is like Check for argv expanded from the alias a. Only the rule
+// of the alias may allow it, so that its options apply even if other rules
+// would match too.
+func (p *Policy) CheckAlias(a *Alias, argv []string) (*Rule, string, error) {
+  path, deny, err := p.denied(argv)
+  if err != nil {
+    return deny, path, err
+  }
+  switch err := a.Rule.match(path, argv[1:]); err {
+  case nil:
+    return a.Rule, path, nil
+  case errNoMatch:
+    return nil, path, ErrForbidden
+  default:
+    return nil, path, err
+  }
+}
+
+// denied resolves the program named by argv[0] and looks for a deny rule
+// matching argv. It returns the resolved path, and the deny rule with
+// ErrDenied if there is one.
+func (p *Policy) denied(argv []string) (string, *Rule, error) {
+  if len(argv) == 0 {
+    return "", nil, errors.New("empty command")
+  }
+  path, err := Resolve(argv[0])
+  if err != nil {
+    return "", nil, ErrForbidden
+  }
+  for _, r := range p.Deny {
+    if r.Match(path, argv[1:]) {
+      return path, r, ErrDenied
+    }
+  }
+  return path, nil, nil
+}
+
+// Resolve returns the canonical path of the program name as typed by a user.
+// Names without a slash are looked up in DefaultPath, relative paths are made
+// absolute. Symbolic links in the directory part are resolved, but the program
+// itself is not followed, so that multi-call binaries keep their identity.
+func Resolve(name string) (string, error) {
+  if !strings.Contains(name, "/") {
+    return LookPath(name)
+  }
+  return canonical(name)
+}
+
+// LookPath searches DefaultPath for an executable with the given name and
+// returns its canonical path.
+func LookPath(name string) (string, error) {
+  for _, dir := range filepath.SplitList(DefaultPath) {
+    path := filepath.Join(dir, name)
+    if isExecutable(path) {
+      return canonical(path)
+    }
+  }
+  return "", ErrNotFound
+}
+
+func canonical(path string) (string, error) {
+  path, err := filepath.Abs(path)
+  if err != nil {
+    return "", err
+  }
+  dir, file := filepath.Split(path)
+  if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+    dir = resolved
+  }
+  return filepath.Join(dir, file), nil
+}
+
+func isExecutable(path string) bool {
+  info, err := os.Stat(path)
+  if err != nil {
+    return false
+  }
+  return info.Mode().IsRegular() && info.Mode()&0111 != 0
+}
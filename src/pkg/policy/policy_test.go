@@ -0,0 +1,349 @@
+package policy
+
+import (
+  "strings"
+  "testing"
+  "time"
+)
+
+var checks = []struct {
+  rule    []string
+  argv    []string
+  allowed bool
+}{
+  {[]string{"/bin/pwd"}, []string{"/bin/pwd"}, true},
+  {[]string{"/bin/pwd"}, []string{"/bin/pwd", "-P"}, false},
+  {[]string{"/bin/date", "+%Y"}, []string{"/bin/date", "+%Y"}, true},
+  {[]string{"/bin/date", "+%Y"}, []string{"/bin/date"}, false},
+  {[]string{"/bin/date", "+%Y"}, []string{"/bin/date", "+%Y", "-u"}, false},
+  {[]string{"/bin/du", "*"}, []string{"/bin/du"}, true},
+  {[]string{"/bin/du", "*"}, []string{"/bin/du", "-h", "/tmp"}, true},
+  {[]string{"/bin/git", "log", "*"}, []string{"/bin/git", "log", "-1"}, true},
+  {[]string{"/bin/git", "log", "*"}, []string{"/bin/git", "push"}, false},
+  {[]string{"/bin/du", "*"}, []string{"/bin/dd", "if=/dev/zero"}, false},
+  {[]string{"/bin/systemctl", "status", "*.service", "@patterns"}, []string{"/bin/systemctl", "status", "sshd.service"}, true},
+  {[]string{"/bin/systemctl", "status", "*.service", "@patterns"}, []string{"/bin/systemctl", "status", "sshd.socket"}, false},
+  {[]string{"/bin/systemctl", "status", "*.service", "@patterns"}, []string{"/bin/systemctl", "status", "../x.service"}, false},
+  {[]string{"/bin/ls", "*.service", "@patterns"}, []string{"/bin/ls", "/etc/x.service"}, false},
+  {[]string{"/bin/kill", "~[0-9]+", "@patterns"}, []string{"/bin/kill", "123"}, true},
+  {[]string{"/bin/kill", "~[0-9]+", "@patterns"}, []string{"/bin/kill", "-9"}, false},
+  {[]string{"/bin/kill", "~[0-9]+", "@patterns"}, []string{"/bin/kill", "1 2"}, false},
+  {[]string{"/bin/echo", "\\*", "@patterns"}, []string{"/bin/echo", "*"}, true},
+  {[]string{"/bin/echo", "\\*", "@patterns"}, []string{"/bin/echo", "x"}, false},
+  {[]string{"/bin/ls", "*.service"}, []string{"/bin/ls", "*.service"}, true},
+  {[]string{"/bin/ls", "*.service"}, []string{"/bin/ls", "x.service"}, false},
+  {[]string{"/bin/ls", "~/foo"}, []string{"/bin/ls", "~/foo"}, true},
+  {[]string{"/bin/ls", "~/foo"}, []string{"/bin/ls", "/foo"}, false},
+  {[]string{"/bin/tar", "*", "@forbid=--to-command,-I"}, []string{"/bin/tar", "-xf", "a.tar"}, true},
+  {[]string{"/bin/tar", "*", "@forbid=--to-command,-I"}, []string{"/bin/tar", "-xf", "a.tar", "--to-command=sh"}, false},
+  {[]string{"/bin/tar", "*", "@forbid=--to-command,-I"}, []string{"/bin/tar", "-xf", "a.tar", "--to-com", "sh"}, false},
+  {[]string{"/bin/tar", "*", "@forbid=--to-command,-I"}, []string{"/bin/tar", "-xIsh", "-f", "a.tar"}, false},
+  {[]string{"/bin/tar", "*", "@forbid=--to-command,-I"}, []string{"/bin/tar", "--totals", "-cf", "a.tar", "x"}, true},
+  {[]string{"/bin/du", "*", "@maxargs=2"}, []string{"/bin/du", "-h", "/tmp"}, true},
+  {[]string{"/bin/du", "*", "@maxargs=2"}, []string{"/bin/du", "-h", "/tmp", "/var"}, false},
+}
+
+func TestCheck(t *testing.T) {
+  for _, tt := range checks {
+    r, err := ParseRule(tt.rule)
+    if err != nil {
+      t.Errorf("ParseRule(%q) => %v, want <nil>", tt.rule, err)
+      continue
+    }
+    p := &Policy{}
+    p.Add(r)
+    _, _, err = p.Check(tt.argv)
+    if allowed := err == nil; allowed != tt.allowed {
+      t.Errorf("rule %q: Check(%q) => %v, want allowed=%v",
+        tt.rule, tt.argv, err, tt.allowed)
+    }
+  }
+}
+
+func TestEmptyPolicy(t *testing.T) {
+  p := &Policy{}
+  if _, _, err := p.Check([]string{"/bin/sh"}); err != ErrForbidden {
+    t.Errorf("Check on empty policy => %v, want %v", err, ErrForbidden)
+  }
+}
+
+func TestWildcardMustBeLast(t *testing.T) {
+  if _, err := ParseRule([]string{"/bin/du", "*", "-h"}); err == nil {
+    t.Error("ParseRule with wildcard in the middle => <nil>, want error")
+  }
+}
+
+func TestMissingProgram(t *testing.T) {
+  r, err := ParseRule([]string{"lish-no-such-program", "*"})
+  if err != ErrNotFound || r == nil {
+    t.Fatalf("ParseRule of a missing program => (%v, %v), want rule and %v", r, err, ErrNotFound)
+  }
+  p := &Policy{}
+  p.Add(r)
+  if missing := p.Resolve(); len(missing) != 1 || missing[0] != r.Name {
+    t.Errorf("Resolve => %q, want [%q]", missing, r.Name)
+  }
+  if _, _, err := p.Check([]string{"lish-no-such-program"}); err != ErrForbidden {
+    t.Errorf("Check => %v, want %v", err, ErrForbidden)
+  }
+}
+
+func TestLimitOption(t *testing.T) {
+  r, err := ParseRule([]string{"/lish/test/make", "*", "@limit=cpu=10,timeout=1m"})
+  if err != nil || r.Limits.String() != "cpu=10,timeout=60" {
+    t.Errorf("ParseRule => (%v, %v), want limits cpu=10,timeout=60", r.Limits, err)
+  }
+  for _, opt := range []string{"@limit", "@limit=cpu", "@limit=core=1"} {
+    if _, err := ParseRule([]string{"/lish/test/make", opt}); err == nil {
+      t.Errorf("ParseRule with %s => <nil>, want error", opt)
+    }
+  }
+}
+
+func TestSeccompOption(t *testing.T) {
+  r, err := ParseRule([]string{"/lish/test/less", "*", "@seccomp=read-only,no-network"})
+  if err != nil || strings.Join(r.Seccomp, " ") != "read-only no-network" {
+    t.Errorf("ParseRule => (%q, %v), want profiles read-only no-network", r.Seccomp, err)
+  }
+  if _, err := ParseRule([]string{"/lish/test/less", "@seccomp=none"}); err == nil {
+    t.Error("ParseRule with unknown profile => <nil>, want error")
+  }
+}
+
+func TestNoEscapeOption(t *testing.T) {
+  r, err := ParseRule([]string{"/lish/test/less", "*", "@noescape"})
+  if err != nil || !r.NoEscape {
+    t.Errorf("ParseRule => (%v, %v), want NoEscape", r, err)
+  }
+  if _, err := ParseRule([]string{"/lish/test/less", "@noescape=yes"}); err == nil {
+    t.Error("ParseRule with @noescape=yes => <nil>, want error")
+  }
+}
+
+func TestConfirmOptions(t *testing.T) {
+  r, err := ParseRule([]string{"/bin/systemctl", "restart", "*", "@confirm", "@justify"})
+  if err != nil || !r.Confirm || !r.Justify {
+    t.Errorf("ParseRule => (%v, %v), want Confirm and Justify", r, err)
+  }
+  if _, err := ParseRule([]string{"/bin/systemctl", "@justify=yes"}); err == nil {
+    t.Error("ParseRule with @justify=yes => <nil>, want error")
+  }
+}
+
+func TestCapsOption(t *testing.T) {
+  r, err := ParseRule([]string{"/lish/test/less", "@caps=net_raw,CAP_NET_BIND_SERVICE"})
+  if err != nil || strings.Join(r.Caps, " ") != "net_raw net_bind_service" {
+    t.Errorf("ParseRule => (%q, %v), want capabilities net_raw net_bind_service", r.Caps, err)
+  }
+  if _, err := ParseRule([]string{"/lish/test/less", "@caps=everything"}); err == nil {
+    t.Error("ParseRule with unknown capability => <nil>, want error")
+  }
+}
+
+func TestPatternErrors(t *testing.T) {
+  for _, rule := range [][]string{
+    {"/bin/ls", "[a-", "@patterns"},
+    {"/bin/ls", "~(x", "@patterns"},
+    {"/bin/ls", "*", "@forbid=[x"},
+    {"/bin/ls", "*", "@maxargs=0"},
+    {"/bin/ls", "*", "@maxargs=x"},
+  } {
+    if _, err := ParseRule(rule); err == nil {
+      t.Errorf("ParseRule(%q) => <nil>, want error", rule)
+    }
+  }
+}
+
+func TestCheckReason(t *testing.T) {
+  r, err := ParseRule([]string{"/bin/tar", "*", "@forbid=--to-command"})
+  if err != nil {
+    t.Fatal(err)
+  }
+  p := &Policy{}
+  p.Add(r)
+  _, _, err = p.Check([]string{"/bin/tar", "-x", "--to-command=sh"})
+  if err == nil || err == ErrForbidden || !strings.Contains(err.Error(), "--to-command=sh") {
+    t.Errorf("Check => %v, want error naming the forbidden argument", err)
+  }
+}
+
+func TestDeny(t *testing.T) {
+  p := &Policy{}
+  for _, fields := range [][]string{{"!/bin/ls", "/etc*", "@patterns"}, {"/bin/ls", "*"}} {
+    r, err := ParseRule(fields)
+    if err != nil {
+      t.Fatal(err)
+    }
+    p.Add(r)
+  }
+  if len(p.Rules) != 1 || len(p.Deny) != 1 || !strings.HasPrefix(p.Deny[0].String(), "!/") {
+    t.Fatalf("Policy => %v allow, %v deny, want one each", p.Rules, p.Deny)
+  }
+  if r, _, err := p.Check([]string{"/bin/ls", "/etc"}); err != ErrDenied || r != p.Deny[0] {
+    t.Errorf("Check(ls /etc) => (%v, %v), want deny rule and %v", r, err, ErrDenied)
+  }
+  for _, argv := range [][]string{
+    {"/bin/ls", "-l", "/etc"}, {"/bin/ls", "/etc/"}, {"/bin/ls", "/etc/shadow"},
+    {"/bin/ls", "/tmp", "//etc/./ssh"}, {"/bin/ls", "--hide=x", "/etc.d/x"},
+  } {
+    if _, _, err := p.Check(argv); err != ErrDenied {
+      t.Errorf("Check(%q) => %v, want %v", argv, err, ErrDenied)
+    }
+  }
+  for _, argv := range [][]string{{"/bin/ls", "/tmp"}, {"/bin/ls", "-l", "/tmp/etc"}, {"/bin/ls"}} {
+    if _, _, err := p.Check(argv); err != nil {
+      t.Errorf("Check(%q) => %v, want <nil>", argv, err)
+    }
+  }
+
+  // A deny rule without arguments denies the program with any.
+  p = &Policy{}
+  for _, fields := range [][]string{{"!/bin/sh"}, {"/bin/sh", "*"}, {"!/bin/ls", "-R", "/"}, {"/bin/ls", "*"}} {
+    r, err := ParseRule(fields)
+    if err != nil {
+      t.Fatal(err)
+    }
+    p.Add(r)
+  }
+  for _, tt := range []struct {
+    argv []string
+    err  error
+  }{
+    {[]string{"/bin/sh"}, ErrDenied},
+    {[]string{"/bin/sh", "-c", "id"}, ErrDenied},
+    {[]string{"/bin/ls", "/", "-la", "-R"}, ErrDenied},
+    {[]string{"/bin/ls", "-R", "/tmp"}, nil},
+    {[]string{"/bin/ls", "/"}, nil},
+  } {
+    if _, _, err := p.Check(tt.argv); err != tt.err {
+      t.Errorf("Check(%q) => %v, want %v", tt.argv, err, tt.err)
+    }
+  }
+  for _, fields := range [][]string{{"!"}, {"!/bin/ls", "*", "@noescape"}} {
+    if _, err := ParseRule(fields); err == nil {
+      t.Errorf("ParseRule(%q) => <nil>, want error", fields)
+    }
+  }
+}
+
+func TestSchedule(t *testing.T) {
+  defer func() { now = time.Now }()
+  r, err := ParseRule([]string{
+    "/bin/ls", "@valid-from=2026-10-01", "@valid-until=2026-10-31",
+    "@window=mon-fri/09:00-18:00,sat/22:00-02:00", "@tz=Europe/Berlin",
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  p := &Policy{}
+  p.Add(r)
+  for _, c := range []struct {
+    time   string
+    reason string
+  }{
+    {"2026-10-19T09:00:00+02:00", ""},
+    {"2026-10-19T18:00:00+02:00", "outside of the time window"},
+    {"2026-10-19T07:30:00Z", ""},
+    {"2026-10-24T23:00:00+02:00", ""},
+    {"2026-10-25T01:30:00+02:00", ""},
+    {"2026-10-25T12:00:00+01:00", "outside of the time window"},
+    {"2026-10-31T17:00:00+01:00", "outside of the time window"},
+    {"2026-09-30T12:00:00+02:00", "not valid before 2026-10-01 00:00 CEST"},
+    {"2026-11-01T00:00:00+01:00", "expired at 2026-11-01 00:00 CET"},
+  } {
+    at, err := time.Parse(time.RFC3339, c.time)
+    if err != nil {
+      t.Fatal(err)
+    }
+    now = func() time.Time { return at }
+    _, _, err = p.Check([]string{"/bin/ls"})
+    if c.reason == "" && err != nil || c.reason != "" && (err == nil || !strings.Contains(err.Error(), c.reason)) {
+      t.Errorf("Check at %s => %v, want %q", c.time, err, c.reason)
+    }
+  }
+  for _, option := range []string{
+    "@valid-from=tomorrow", "@valid-until=2026-13-01", "@window=mon-xyz", "@window=25:00-26:00",
+    "@window=9:00-18:00", "@tz=Nowhere/Special",
+  } {
+    if _, err := ParseRule([]string{"/bin/ls", option}); err == nil {
+      t.Errorf("ParseRule with %s => <nil>, want error", option)
+    }
+  }
+  if _, err := ParseRule([]string{"/bin/ls", "@valid-from=2026-10-02", "@valid-until=2026-10-01"}); err == nil {
+    t.Error("ParseRule with @valid-until before @valid-from => <nil>, want error")
+  }
+}
+
+func TestAlias(t *testing.T) {
+  a, err := ParseAlias(strings.Fields(
+    "logs <since:duration> <unit:nginx|php-fpm> = /bin/ls --since=-{since} -u {unit}.service [x] @maxargs=4"))
+  if err != nil {
+    t.Fatal(err)
+  }
+  p := &Policy{}
+  if err := p.AddAlias(a); err != nil || p.Alias("logs") != a || len(p.Rules) != 1 {
+    t.Fatalf("AddAlias => %v, want the alias and its rule", err)
+  }
+  if err := p.AddAlias(a); err == nil {
+    t.Error("AddAlias twice => <nil>, want error")
+  }
+  argv, err := a.Expand([]string{"90m", "php-fpm"})
+  if want := "/bin/ls --since=-90m -u php-fpm.service [x]"; err != nil || strings.Join(argv, " ") != want {
+    t.Fatalf("Expand => (%q, %v), want %q", argv, err, want)
+  }
+  if r, _, err := p.Check(argv); err != nil || r != a.Rule {
+    t.Errorf("Check(%q) => (%v, %v), want the rule of the alias", argv, r, err)
+  }
+  for _, argv := range [][]string{
+    {"/bin/ls", "--since=-1h", "-u", "sshd.service", "[x]"},
+    {"/bin/ls", "--since=-1h", "-u", "nginx.service", "x"},
+    {"/bin/ls", "--since=-1y", "-u", "nginx.service", "[x]"},
+  } {
+    if _, _, err := p.Check(argv); err == nil {
+      t.Errorf("Check(%q) => <nil>, want error", argv)
+    }
+  }
+  for _, args := range [][]string{{"1h"}, {"1h", "sshd"}, {"-1h", "nginx"}, {"1h;", "nginx"}} {
+    if _, err := a.Expand(args); err == nil {
+      t.Errorf("Expand(%q) => <nil>, want error", args)
+    }
+  }
+  // Earlier rules covering the expansion do not apply to the alias.
+  p = &Policy{}
+  for _, fields := range [][]string{{"/bin/ls", "*"}, {"!/bin/ls", "--since=-1h", "*"}} {
+    r, err := ParseRule(fields)
+    if err != nil {
+      t.Fatal(err)
+    }
+    p.Add(r)
+  }
+  if err := p.AddAlias(a); err != nil {
+    t.Fatal(err)
+  }
+  if r, _, err := p.CheckAlias(a, argv); err != nil || r != a.Rule {
+    t.Errorf("CheckAlias(%q) => (%v, %v), want the rule of the alias", argv, r, err)
+  }
+  if r, _, err := p.Check(argv); err != nil || r != p.Rules[0] {
+    t.Errorf("Check(%q) => (%v, %v), want the earlier rule", argv, r, err)
+  }
+  denied := []string{"/bin/ls", "--since=-1h", "-u", "nginx.service", "[x]"}
+  if r, _, err := p.CheckAlias(a, denied); err != ErrDenied || r != p.Deny[0] {
+    t.Errorf("CheckAlias(%q) => (%v, %v), want the deny rule", denied, r, err)
+  }
+  for _, def := range []string{
+    "logs",
+    "logs = ",
+    "cd = /bin/ls",
+    "logs <since> = /bin/ls {since}",
+    "logs <since:time> = /bin/ls {since}",
+    "logs <since:int> = /bin/ls",
+    "logs = /bin/ls {since}",
+    "logs <n:int> = /bin/ls {n",
+    "logs <n:int> = {n}",
+    "logs <n:-x|y> = /bin/ls {n}",
+  } {
+    if _, err := ParseAlias(strings.Fields(def)); err == nil {
+      t.Errorf("ParseAlias(%q) => <nil>, want error", def)
+    }
+  }
+}
@@ -0,0 +1,109 @@
+package policy
+
+import (
+  "errors"
+  "fmt"
+  "os"
+  "path/filepath"
+  "strings"
+)
+
+// ErrOutsideRoots is returned when a path is not within the allowed
+// directories.
+var ErrOutsideRoots = errors.New("outside of the allowed directories")
+
+// Roots is a set of canonical directories that a user is confined to,
+// together with everything below them. An empty Roots does not confine at all.
+type Roots []string
+
+// NewRoots canonicalizes the given directories. It fails if any of them
+// cannot be resolved, rather than silently granting less or, if none is left,
+// more than was configured.
+func NewRoots(dirs []string) (Roots, error) {
+  var r Roots
+  for _, dir := range dirs {
+    path, err := filepath.EvalSymlinks(dir)
+    if err != nil {
+      return nil, err
+    }
+    if info, err := os.Stat(path); err != nil {
+      return nil, err
+    } else if !info.IsDir() {
+      return nil, fmt.Errorf("%s: not a directory", dir)
+    }
+    r = append(r, path)
+  }
+  return r, nil
+}
+
+// Contains reports whether the canonical path is one of the roots or below
+// one of them.
+func (r Roots) Contains(path string) bool {
+  if len(r) == 0 {
+    return true
+  }
+  for _, root := range r {
+    if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+      return true
+    }
+  }
+  return false
+}
+
+// Check canonicalizes path with CanonicalPath and returns the result, or
+// ErrOutsideRoots if it is not contained in the roots.
+func (r Roots) Check(path string) (string, error) {
+  canon, err := CanonicalPath(path)
+  if err != nil {
+    return "", err
+  }
+  if !r.Contains(canon) {
+    return canon, ErrOutsideRoots
+  }
+  return canon, nil
+}
+
+// CanonicalPath returns the absolute form of path with symbolic links and ".."
+// resolved in the same order as the kernel does, which a lexical
+// filepath.Clean does not. Trailing components that do not exist yet are kept
+// as long as they are neither ".." nor dangling symbolic links, so that paths
+// of files about to be created can be checked too.
+func CanonicalPath(path string) (string, error) {
+  if path == "" {
+    return "", errors.New("empty path")
+  }
+  if !filepath.IsAbs(path) {
+    wd, err := os.Getwd()
+    if err != nil {
+      return "", err
+    }
+    path = wd + "/" + path
+  }
+  var rest []string
+  for p := path; ; {
+    resolved, err := filepath.EvalSymlinks(p)
+    if err == nil {
+      return filepath.Join(append([]string{resolved}, rest...)...), nil
+    }
+    if !os.IsNotExist(err) {
+      return "", err
+    }
+    p = strings.TrimRight(p, "/")
+    i := strings.LastIndex(p, "/")
+    name := p[i+1:]
+    switch name {
+    case "..":
+      return "", fmt.Errorf("%s: cannot resolve '..' below a missing directory", path)
+    case ".":
+    default:
+      if _, err := os.Lstat(p); err == nil {
+        return "", fmt.Errorf("%s: dangling symbolic link", p)
+      }
+      rest = append([]string{name}, rest...)
+    }
+    p = p[:i]
+    if p == "" {
+      p = "/"
+    }
+  }
+}
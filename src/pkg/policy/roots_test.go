@@ -0,0 +1,67 @@
+package policy
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+func TestRoots(t *testing.T) {
+  tmp, err := ioutil.TempDir("", "lish.roots")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(tmp)
+  tmp, _ = filepath.EvalSymlinks(tmp)
+  allowed := filepath.Join(tmp, "allowed")
+  other := filepath.Join(tmp, "other")
+  for _, dir := range []string{allowed + "/sub", other} {
+    if err := os.MkdirAll(dir, 0755); err != nil {
+      t.Fatal(err)
+    }
+  }
+  os.Symlink(other, allowed+"/escape")
+  os.Symlink(allowed+"/sub", other+"/in")
+  os.Symlink(other+"/missing", allowed+"/dangling")
+
+  roots, err := NewRoots([]string{allowed})
+  if err != nil {
+    t.Fatalf("NewRoots => %v, want <nil>", err)
+  }
+  checks := []struct {
+    path string
+    want string
+    ok   bool
+  }{
+    {allowed, allowed, true},
+    {allowed + "/sub/../sub", allowed + "/sub", true},
+    {allowed + "/new/file", allowed + "/new/file", true},
+    {other + "/in", allowed + "/sub", true},
+    {allowed + "/../other", other, false},
+    {allowed + "/escape", other, false},
+    {allowed + "/escape/../allowed", allowed, true},
+    {allowed + "/sub/../../other", other, false},
+    {allowed + "x", allowed + "x", false},
+    {"/", "/", false},
+  }
+  for _, tt := range checks {
+    got, err := roots.Check(tt.path)
+    if got != tt.want || (err == nil) != tt.ok {
+      t.Errorf("Check(%q) => (%q, %v), want (%q, ok=%v)",
+        tt.path, got, err, tt.want, tt.ok)
+    }
+  }
+  for _, path := range []string{allowed + "/dangling", allowed + "/new/../x"} {
+    if _, err := roots.Check(path); err == nil {
+      t.Errorf("Check(%q) => <nil>, want error", path)
+    }
+  }
+
+  if _, err := NewRoots([]string{filepath.Join(tmp, "missing")}); err == nil {
+    t.Error("NewRoots with a missing directory => <nil>, want error")
+  }
+  if !(Roots{}).Contains("/etc/shadow") {
+    t.Error("empty Roots should not confine")
+  }
+}
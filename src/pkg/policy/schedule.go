@@ -0,0 +1,190 @@
+package policy
+
+import (
+  "errors"
+  "fmt"
+  "strings"
+  "time"
+)
+
+// now returns the current time. Tests replace it.
+var now = time.Now
+
+// Schedule restricts when a rule applies: not before From, not from Until on,
+// if they are set, and only within one of Windows, if there are any.
+type Schedule struct {
+  From, Until time.Time
+  Windows     []Window
+  // Location is the time zone of Windows, and of From and Until if they were
+  // given without one.
+  Location *time.Location
+
+  // from and until are From and Until as written, to be parsed by compile
+  // once Location is known.
+  from, until string
+}
+
+// Window is a recurring span of time, such as "mon-fri/09:00-18:00".
+type Window struct {
+  // Days is indexed by time.Weekday.
+  Days [7]bool
+  // Start and End are minutes since midnight. If End is not after Start, the
+  // window ends on the following day.
+  Start, End int
+  text       string
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// timeLayouts are the layouts accepted by @valid-from and @valid-until.
+var timeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"}
+
+// dateLayout is the last of timeLayouts.
+const dateLayout = "2006-01-02"
+
+// timeFormat is used in reasons.
+const timeFormat = "2006-01-02 15:04 MST"
+
+// compile parses From and Until.
+func (s *Schedule) compile() error {
+  if s.Location == nil {
+    s.Location = time.Local
+  }
+  var err error
+  if s.from != "" {
+    if s.From, err = parseTime(s.from, s.Location, false); err != nil {
+      return err
+    }
+  }
+  if s.until != "" {
+    if s.Until, err = parseTime(s.until, s.Location, true); err != nil {
+      return err
+    }
+  }
+  if !s.From.IsZero() && !s.Until.IsZero() && !s.Until.After(s.From) {
+    return errors.New("@valid-until must be after @valid-from")
+  }
+  return nil
+}
+
+// parseTime parses a time in one of timeLayouts. A date alone stands for the
+// start of the day or, if end is set, for its end.
+func parseTime(text string, loc *time.Location, end bool) (time.Time, error) {
+  for _, layout := range timeLayouts {
+    t, err := time.ParseInLocation(layout, text, loc)
+    if err != nil {
+      continue
+    }
+    if layout == dateLayout && end {
+      t = t.AddDate(0, 0, 1)
+    }
+    return t, nil
+  }
+  return time.Time{}, fmt.Errorf("invalid time %q, want YYYY-MM-DD[THH:MM]", text)
+}
+
+// parseWindow parses a window of the form DAYS/HH:MM-HH:MM, where either part
+// may be left out. DAYS is a day such as "mon", a range such as "mon-fri",
+// or such days and ranges joined by '+'.
+func parseWindow(text string) (Window, error) {
+  w := Window{End: 24 * 60, text: text}
+  days, hours := "", text
+  if i := strings.IndexByte(text, '/'); i >= 0 {
+    days, hours = text[:i], text[i+1:]
+  } else if !strings.Contains(text, ":") {
+    days, hours = text, ""
+  }
+  if days == "" {
+    for i := range w.Days {
+      w.Days[i] = true
+    }
+  }
+  for _, span := range strings.Split(days, "+") {
+    if days == "" {
+      break
+    }
+    first, last := span, span
+    if i := strings.IndexByte(span, '-'); i >= 0 {
+      first, last = span[:i], span[i+1:]
+    }
+    d, e := weekday(first), weekday(last)
+    if d < 0 || e < 0 {
+      return w, fmt.Errorf("invalid days %q", span)
+    }
+    for ; d != e; d = (d + 1) % 7 {
+      w.Days[d] = true
+    }
+    w.Days[e] = true
+  }
+  if hours != "" {
+    i := strings.IndexByte(hours, '-')
+    if i < 0 {
+      return w, fmt.Errorf("invalid hours %q, want HH:MM-HH:MM", hours)
+    }
+    var err error
+    if w.Start, err = minutes(hours[:i]); err != nil {
+      return w, err
+    }
+    if w.End, err = minutes(hours[i+1:]); err != nil {
+      return w, err
+    }
+  }
+  return w, nil
+}
+
+func weekday(name string) int {
+  for i, day := range weekdays {
+    if strings.EqualFold(name, day) {
+      return i
+    }
+  }
+  return -1
+}
+
+// minutes parses HH:MM into minutes since midnight; 24:00 is allowed.
+func minutes(text string) (int, error) {
+  var h, m int
+  if n, err := fmt.Sscanf(text, "%d:%d", &h, &m); err != nil || n != 2 || len(text) != 5 ||
+    h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+    return 0, fmt.Errorf("invalid time of day %q", text)
+  }
+  return h*60 + m, nil
+}
+
+// contains reports whether the window contains t.
+func (w *Window) contains(t time.Time) bool {
+  day, m := t.Weekday(), t.Hour()*60+t.Minute()
+  if w.Start < w.End {
+    return w.Days[day] && w.Start <= m && m < w.End
+  }
+  // Past midnight, the window belongs to the day before.
+  return w.Days[day] && m >= w.Start || w.Days[(day+6)%7] && m < w.End
+}
+
+// check returns an error saying why the schedule does not allow a command at
+// time t, or nil.
+func (s *Schedule) check(t time.Time) error {
+  if !s.From.IsZero() && t.Before(s.From) {
+    return fmt.Errorf("rule not valid before %s", s.From.In(s.Location).Format(timeFormat))
+  }
+  if !s.Until.IsZero() && !t.Before(s.Until) {
+    return fmt.Errorf("rule expired at %s", s.Until.In(s.Location).Format(timeFormat))
+  }
+  if len(s.Windows) == 0 {
+    return nil
+  }
+  local := t.In(s.Location)
+  var texts []string
+  for i := range s.Windows {
+    if s.Windows[i].contains(local) {
+      return nil
+    }
+    texts = append(texts, s.Windows[i].text)
+  }
+  return fmt.Errorf("outside of the time window %s (%s)", strings.Join(texts, ","), s.Location)
+}
+
+// Expired reports whether the schedule allows nothing from t on.
+func (s *Schedule) Expired(t time.Time) bool {
+  return !s.Until.IsZero() && !t.Before(s.Until)
+}
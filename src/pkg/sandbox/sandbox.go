@@ -0,0 +1,210 @@
+// Package sandbox runs commands in isolated Linux namespaces, with resource
+// limits, seccomp filters and reduced privileges.
+//
+// Some of the isolation has to be set up by the new process itself, between
+// its creation and the execution of the command. Since that cannot be done in
+// Go, the shell runs its own binary in a helper mode, which reads a Spec from
+// file descriptor 3, sets up the sandbox and then executes the command. The
+// helper may run with more privileges than whoever starts it, so it only
+// accepts a Spec handed over by a process with its own effective identity,
+// see checkPeer.
+package sandbox
+
+import (
+  "encoding/json"
+  "errors"
+  "fmt"
+  "os"
+  "os/exec"
+  "path/filepath"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/limits"
+  "github.com/m9rco/phoenix-shell/src/pkg/util"
+)
+
+// Flag is the only argument of the binary when it runs as the sandbox helper,
+// see IsHelper. It is not one of the flags of the shell.
+const Flag = "-sandbox"
+
+// specFd is the file descriptor on which the helper reads its Spec.
+const specFd = 3
+
+// maxSpecSize bounds the encoded Spec so that it always fits into a pipe
+// buffer and can be written before the helper is started.
+const maxSpecSize = 64 * 1024
+
+var logger = util.GetLogger("[sandbox] ")
+
+// Namespaces lists the names of the namespaces that can be unshared.
+var Namespaces = []string{"mount", "pid", "ipc", "uts", "net"}
+
+// Spec describes a command and the sandbox to run it in.
+type Spec struct {
+  Path string   `json:"path"`
+  Argv []string `json:"argv"`
+  Env  []string `json:"env"`
+  Dir  string   `json:"dir"`
+  // Namespaces lists the namespaces the command gets fresh instances of.
+  Namespaces []string `json:"namespaces,omitempty"`
+  // Binds lists the directories that stay accessible, read-write, within a
+  // new mount namespace. The system directories are always available
+  // read-only. If Binds is empty the file system is not restricted.
+  Binds []string `json:"binds,omitempty"`
+  // Limits holds the resource limits of the command. The timeout is not
+  // enforced by the helper.
+  Limits limits.Limits `json:"limits,omitempty"`
+  // Seccomp lists the seccomp profiles installed for the command.
+  Seccomp []string `json:"seccomp,omitempty"`
+  // Credential, if not nil, is the identity the command runs as. Caps lists
+  // the capabilities it keeps, see Capabilities; all others are dropped
+  // from the bounding set when the identity is switched. NoNewPrivs keeps
+  // it from gaining privileges through setuid programs or file
+  // capabilities.
+  Credential *Credential `json:"credential,omitempty"`
+  Caps       []string    `json:"caps,omitempty"`
+  NoNewPrivs bool        `json:"no_new_privs,omitempty"`
+}
+
+// NeedsHelper reports whether running spec requires the sandbox helper,
+// rather than executing the command directly. Switching to a Credential
+// does, as only the helper drops the capabilities the command is not given.
+func (spec *Spec) NeedsHelper() bool {
+  return len(spec.Namespaces) > 0 || spec.Limits.HasRlimits() || len(spec.Seccomp) > 0 ||
+    spec.Credential != nil || len(spec.Caps) > 0 || spec.NoNewPrivs
+}
+
+// validate checks what the helper relies on when running spec.
+func (spec *Spec) validate() error {
+  if !filepath.IsAbs(spec.Path) {
+    return fmt.Errorf("program %q is not an absolute path", spec.Path)
+  }
+  if len(spec.Argv) == 0 {
+    return errors.New("no arguments")
+  }
+  if spec.Dir != "" && !filepath.IsAbs(spec.Dir) {
+    return fmt.Errorf("directory %q is not an absolute path", spec.Dir)
+  }
+  for _, name := range spec.Namespaces {
+    if !isNamespace(name) {
+      return fmt.Errorf("unknown namespace %q", name)
+    }
+  }
+  for _, dir := range spec.Binds {
+    if !filepath.IsAbs(dir) {
+      return fmt.Errorf("directory %q is not an absolute path", dir)
+    }
+  }
+  for _, name := range spec.Caps {
+    if _, ok := Capabilities[name]; !ok {
+      return fmt.Errorf("unknown capability %q", name)
+    }
+  }
+  return nil
+}
+
+// IsHelper reports whether the command-line arguments args, including the
+// name of the program, ask for the sandbox helper.
+func IsHelper(args []string) bool {
+  return len(args) == 2 && args[1] == Flag
+}
+
+// Cmd is a command run by the sandbox helper.
+type Cmd struct {
+  *exec.Cmd
+  // Prepare, if not nil, is called with the process ID of the helper once
+  // it has started. The helper waits for its specification until then, so
+  // that nothing of the command runs before Prepare has returned.
+  Prepare func(pid int) error
+
+  data []byte
+  r, w *os.File
+}
+
+// Command returns a Cmd running spec through the sandbox helper, which is the
+// binary at self.
+func Command(self string, spec *Spec) (*Cmd, error) {
+  if !supported {
+    return nil, errors.New("sandboxes are not supported on this platform")
+  }
+  if err := spec.validate(); err != nil {
+    return nil, err
+  }
+  data, err := json.Marshal(spec)
+  if err != nil {
+    return nil, err
+  }
+  if len(data) > maxSpecSize {
+    return nil, errors.New("sandbox specification too large")
+  }
+  r, w, err := specChannel()
+  if err != nil {
+    return nil, err
+  }
+
+  c := exec.Command(self, Flag)
+  c.Env = []string{}
+  c.Dir = spec.Dir
+  c.ExtraFiles = []*os.File{r}
+  c.SysProcAttr = sysProcAttr(spec)
+  return &Cmd{Cmd: c, data: data, r: r, w: w}, nil
+}
+
+// Start starts the helper, calls Prepare and hands the specification over.
+func (c *Cmd) Start() error {
+  err := c.Cmd.Start()
+  c.r.Close()
+  if err != nil {
+    c.w.Close()
+    return err
+  }
+  if c.Prepare != nil {
+    err = c.Prepare(c.Process.Pid)
+  }
+  if err == nil {
+    // The specification fits into the socket buffer, see maxSpecSize.
+    _, err = c.w.Write(c.data)
+  }
+  c.w.Close()
+  if err != nil {
+    c.Process.Kill()
+    c.Wait()
+    return err
+  }
+  return nil
+}
+
+// Run starts the command and waits for it to complete.
+func (c *Cmd) Run() error {
+  if err := c.Start(); err != nil {
+    return err
+  }
+  return c.Wait()
+}
+
+func readSpec() (*Spec, error) {
+  f := os.NewFile(specFd, "spec")
+  if f == nil {
+    return nil, errors.New("no specification given")
+  }
+  defer f.Close()
+  if err := checkPeer(f); err != nil {
+    return nil, err
+  }
+  spec := &Spec{}
+  if err := json.NewDecoder(f).Decode(spec); err != nil {
+    return nil, fmt.Errorf("reading specification: %v", err)
+  }
+  if err := spec.validate(); err != nil {
+    return nil, fmt.Errorf("invalid specification: %v", err)
+  }
+  return spec, nil
+}
+
+func isNamespace(name string) bool {
+  for _, ns := range Namespaces {
+    if name == ns {
+      return true
+    }
+  }
+  return false
+}
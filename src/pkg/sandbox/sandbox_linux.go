@@ -0,0 +1,487 @@
+package sandbox
+
+import (
+  "errors"
+  "fmt"
+  "os"
+  "os/exec"
+  "os/signal"
+  "path/filepath"
+  "runtime"
+  "syscall"
+
+  "golang.org/x/sys/unix"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/limits"
+  "github.com/m9rco/phoenix-shell/src/pkg/seccomp"
+)
+
+const supported = true
+
+var cloneFlags = map[string]uintptr{
+  "mount": syscall.CLONE_NEWNS,
+  "pid":   syscall.CLONE_NEWPID,
+  "ipc":   syscall.CLONE_NEWIPC,
+  "uts":   syscall.CLONE_NEWUTS,
+  "net":   syscall.CLONE_NEWNET,
+}
+
+// systemDirs are made available read-only when the file system is
+// restricted to Spec.Binds.
+var systemDirs = []string{
+  "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/libx32", "/usr", "/etc",
+}
+
+func sysProcAttr(spec *Spec) *syscall.SysProcAttr {
+  attr := &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+  for _, name := range spec.Namespaces {
+    attr.Cloneflags |= cloneFlags[name]
+  }
+  if attr.Cloneflags&syscall.CLONE_NEWPID != 0 {
+    // The processes of the host stay visible without a /proc of the new
+    // PID namespace, which takes a mount namespace to mount; see setup.
+    attr.Cloneflags |= syscall.CLONE_NEWNS
+  }
+  if attr.Cloneflags != 0 && os.Geteuid() != 0 {
+    // Unprivileged users get the capabilities needed to set up the other
+    // namespaces within a user namespace of their own. The identity
+    // mapping keeps their uid and gid, so the helper needs CAP_SYS_ADMIN as
+    // an ambient capability to keep it across execve. It is dropped again
+    // before the command is run.
+    attr.Cloneflags |= syscall.CLONE_NEWUSER
+    attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+    attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+    attr.GidMappingsEnableSetgroups = false
+    attr.AmbientCaps = []uintptr{unix.CAP_SYS_ADMIN}
+  }
+  return attr
+}
+
+// specChannel returns the ends of a socket pair, which the Spec is read from
+// and written to. Unlike a pipe, it tells the helper who created it.
+func specChannel() (r, w *os.File, err error) {
+  fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+  if err != nil {
+    return nil, nil, fmt.Errorf("socketpair: %v", err)
+  }
+  return os.NewFile(uintptr(fds[0]), "spec"), os.NewFile(uintptr(fds[1]), "spec"), nil
+}
+
+// checkPeer makes sure that the Spec read from f comes from a socket pair
+// created with our effective uid and gid. The helper is our own binary, which
+// may be setuid or setgid; started by anyone but the shell, it would run
+// commands with privileges they do not have.
+func checkPeer(f *os.File) error {
+  cred, err := unix.GetsockoptUcred(int(f.Fd()), unix.SOL_SOCKET, unix.SO_PEERCRED)
+  if err != nil {
+    return errors.New("specification not handed over by the shell")
+  }
+  if int(cred.Uid) != os.Geteuid() || int(cred.Gid) != os.Getegid() {
+    return fmt.Errorf("specification from uid %d, gid %d refused", cred.Uid, cred.Gid)
+  }
+  return nil
+}
+
+// rlimits maps the names of limits to the resources of the kernel.
+var rlimits = map[string]int{
+  "cpu":    unix.RLIMIT_CPU,
+  "as":     unix.RLIMIT_AS,
+  "nproc":  unix.RLIMIT_NPROC,
+  "nofile": unix.RLIMIT_NOFILE,
+  "fsize":  unix.RLIMIT_FSIZE,
+}
+
+// Init is the entry point of the sandbox helper. It sets up the sandbox
+// described by the Spec read from file descriptor 3 and runs the command in
+// it. On success, it does not return if it can replace itself with the
+// command, or returns the exit status of the command otherwise.
+//
+// The first process of a PID namespace has to stay around, so it runs a
+// second stage of the helper without namespaces, which applies the
+// restrictions of the command to itself only and executes it.
+func Init() int {
+  // Capabilities are per thread, so everything from here to the execution
+  // of the command has to happen on the same one.
+  runtime.LockOSThread()
+  spec, err := readSpec()
+  if err == nil {
+    err = setup(spec)
+  }
+  if err == nil {
+    err = dropHelperCaps()
+  }
+  if err != nil {
+    fmt.Fprintln(os.Stderr, "phoenix-shell: sandbox:", err)
+    return 1
+  }
+  if os.Getpid() == 1 {
+    return runAsInit(spec)
+  }
+  if err := setRlimits(spec.Limits); err != nil {
+    fmt.Fprintln(os.Stderr, "phoenix-shell: sandbox:", err)
+    return 1
+  }
+  if err := dropPrivileges(spec); err != nil {
+    fmt.Fprintln(os.Stderr, "phoenix-shell: sandbox:", err)
+    return 1
+  }
+  // The seccomp filter is installed last, as it may deny calls needed
+  // before.
+  err = seccomp.Exec(spec.Seccomp, spec.Path, spec.Argv, spec.Env)
+  fmt.Fprintf(os.Stderr, "phoenix-shell: %s: %v\n", spec.Argv[0], err)
+  return 1
+}
+
+// setup prepares the mount namespace, if there is one. A PID namespace comes
+// with one, which only gets a fresh /proc unless the mount namespace has been
+// asked for too.
+func setup(spec *Spec) error {
+  mount := hasNamespace(spec, "mount")
+  if !mount && !hasNamespace(spec, "pid") {
+    return nil
+  }
+  // Keep all further mounts to ourselves.
+  if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+    return fmt.Errorf("making mounts private: %v", err)
+  }
+  if mount && len(spec.Binds) > 0 {
+    if err := pivotToBinds(spec); err != nil {
+      return err
+    }
+  } else if hasNamespace(spec, "pid") {
+    if err := mountProc("/proc"); err != nil {
+      return err
+    }
+  }
+  return os.Chdir(spec.Dir)
+}
+
+// pivotToBinds replaces the root file system with a tmpfs that only contains
+// the system directories, read-only, and the directories of Spec.Binds.
+//
+// The tmpfs is mounted over /tmp and made the root first, with the old root
+// below /oldroot. This leaves the original /tmp visible, should it be needed
+// as a source of a bind mount, and the new root is then assembled below
+// /newroot from the sources below /oldroot.
+func pivotToBinds(spec *Spec) error {
+  if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+    return fmt.Errorf("mounting tmpfs: %v", err)
+  }
+  for _, dir := range []string{"/tmp/oldroot", "/tmp/newroot"} {
+    if err := os.Mkdir(dir, 0755); err != nil {
+      return err
+    }
+  }
+  if err := pivot("/tmp", "oldroot"); err != nil {
+    return err
+  }
+  if err := os.Chdir("/"); err != nil {
+    return err
+  }
+  if err := unix.Mount("/newroot", "/newroot", "", unix.MS_BIND, ""); err != nil {
+    return fmt.Errorf("mounting new root: %v", err)
+  }
+
+  for _, dir := range systemDirs {
+    if err := bindSystemDir(dir); err != nil {
+      return err
+    }
+  }
+  if err := bind("/dev", false); err != nil {
+    return err
+  }
+  if hasNamespace(spec, "pid") {
+    if err := mountProc("/newroot/proc"); err != nil {
+      return err
+    }
+  }
+  if err := os.MkdirAll("/newroot/tmp", 0755); err != nil {
+    return err
+  }
+  if err := unix.Mount("tmpfs", "/newroot/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+    return fmt.Errorf("mounting /tmp: %v", err)
+  }
+  for _, dir := range spec.Binds {
+    if err := bind(dir, false); err != nil {
+      return err
+    }
+  }
+
+  if err := unix.Unmount("/oldroot", unix.MNT_DETACH); err != nil {
+    return fmt.Errorf("unmounting old root: %v", err)
+  }
+  // Stacking the old root on top of the new one and detaching it leaves
+  // nothing of the old root reachable.
+  if err := pivot("/newroot", "."); err != nil {
+    return err
+  }
+  if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+    return fmt.Errorf("unmounting old root: %v", err)
+  }
+  return os.Chdir("/")
+}
+
+func pivot(newRoot, putOld string) error {
+  if err := os.Chdir(newRoot); err != nil {
+    return err
+  }
+  if err := unix.PivotRoot(".", putOld); err != nil {
+    return fmt.Errorf("pivot_root: %v", err)
+  }
+  return nil
+}
+
+// bindSystemDir makes a system directory available read-only below /newroot.
+// Symbolic links, as in merged /usr layouts, are copied instead.
+func bindSystemDir(dir string) error {
+  info, err := os.Lstat("/oldroot" + dir)
+  if os.IsNotExist(err) {
+    return nil
+  } else if err != nil {
+    return err
+  }
+  if info.Mode()&os.ModeSymlink != 0 {
+    target, err := os.Readlink("/oldroot" + dir)
+    if err != nil {
+      return err
+    }
+    return os.Symlink(target, "/newroot"+dir)
+  }
+  return bind(dir, true)
+}
+
+// bind mounts dir from below /oldroot to the same place below /newroot.
+func bind(dir string, readOnly bool) error {
+  src, dst := "/oldroot"+dir, "/newroot"+dir
+  if err := os.MkdirAll(dst, 0755); err != nil {
+    return err
+  }
+  if err := unix.Mount(src, dst, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+    return fmt.Errorf("binding %s: %v", dir, err)
+  }
+  if !readOnly {
+    return nil
+  }
+  // A bind mount only becomes read-only when remounted. Flags locked by a
+  // user namespace have to be given again, or the remount is refused.
+  var st unix.Statfs_t
+  if err := unix.Statfs(dst, &st); err != nil {
+    return err
+  }
+  flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+  for _, f := range [][2]uintptr{
+    {unix.ST_NOSUID, unix.MS_NOSUID}, {unix.ST_NODEV, unix.MS_NODEV},
+    {unix.ST_NOEXEC, unix.MS_NOEXEC}, {unix.ST_NOATIME, unix.MS_NOATIME},
+    {unix.ST_NODIRATIME, unix.MS_NODIRATIME}, {unix.ST_RELATIME, unix.MS_RELATIME},
+  } {
+    if uintptr(st.Flags)&f[0] != 0 {
+      flags |= f[1]
+    }
+  }
+  if err := unix.Mount("", dst, "", flags, ""); err != nil {
+    return fmt.Errorf("remounting %s read-only: %v", dir, err)
+  }
+  return nil
+}
+
+func mountProc(dir string) error {
+  if err := os.MkdirAll(dir, 0555); err != nil {
+    return err
+  }
+  err := unix.Mount("proc", dir, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+  if err != nil {
+    return fmt.Errorf("mounting %s: %v", filepath.Clean(dir), err)
+  }
+  return nil
+}
+
+// runAsInit runs the command as a child, through the second stage of the
+// helper, since the first process of a PID namespace does not get the default
+// action of signals it has no handler for, and returns its exit status.
+// Signals that are not sent to the whole process group by the terminal are
+// forwarded. When we exit, the kernel kills whatever is left in the
+// namespace.
+func runAsInit(spec *Spec) int {
+  stage := *spec
+  stage.Namespaces, stage.Binds = nil, nil
+  // Our own executable need not be reachable in the new root.
+  c, err := Command("/proc/self/exe", &stage)
+  if err != nil {
+    fmt.Fprintln(os.Stderr, "phoenix-shell: sandbox:", err)
+    return 1
+  }
+  c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+  sigs := make(chan os.Signal, 8)
+  signal.Notify(sigs)
+  if err := c.Start(); err != nil {
+    fmt.Fprintf(os.Stderr, "phoenix-shell: %s: %v\n", spec.Argv[0], err)
+    return 1
+  }
+  go func() {
+    for sig := range sigs {
+      switch sig {
+      case syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTSTP, syscall.SIGCHLD, syscall.SIGURG:
+      default:
+        c.Process.Signal(sig)
+      }
+    }
+  }()
+  err = c.Wait()
+  if exitError, ok := err.(*exec.ExitError); ok {
+    ws := exitError.Sys().(syscall.WaitStatus)
+    if ws.Signaled() {
+      return 128 + int(ws.Signal())
+    }
+    return ws.ExitStatus()
+  } else if err != nil {
+    logger.Println("wait:", err)
+    return 1
+  }
+  return 0
+}
+
+// setRlimits sets both the soft and the hard resource limits of the current
+// process, so that the command cannot raise them again. Limits above the
+// current hard limit are capped to it.
+func setRlimits(l limits.Limits) error {
+  for name, value := range l {
+    resource, ok := rlimits[name]
+    if !ok {
+      continue
+    }
+    var rlim unix.Rlimit
+    if err := unix.Getrlimit(resource, &rlim); err != nil {
+      return fmt.Errorf("getting limit %s: %v", name, err)
+    }
+    if value < rlim.Max {
+      rlim.Max = value
+    }
+    rlim.Cur = rlim.Max
+    if err := unix.Setrlimit(resource, &rlim); err != nil {
+      return fmt.Errorf("setting limit %s: %v", name, err)
+    }
+  }
+  return nil
+}
+
+// maxCap is beyond the highest capability any kernel knows of.
+const maxCap = 63
+
+// dropPrivileges switches to Spec.Credential, keeping only the capabilities
+// of Spec.Caps, and sets no_new_privs if asked to.
+func dropPrivileges(spec *Spec) error {
+  keep := map[int]bool{}
+  for _, name := range spec.Caps {
+    c, ok := Capabilities[name]
+    if !ok {
+      return fmt.Errorf("unknown capability %q", name)
+    }
+    keep[c] = true
+  }
+  if cred := spec.Credential; cred != nil {
+    // The bounding set can only be reduced while we have CAP_SETPCAP.
+    if err := dropBoundingSet(keep); err != nil {
+      return err
+    }
+    if len(keep) > 0 {
+      if err := unix.Prctl(unix.PR_SET_KEEPCAPS, 1, 0, 0, 0); err != nil {
+        return fmt.Errorf("keeping capabilities: %v", err)
+      }
+    }
+    if cred.Groups != nil {
+      groups := make([]int, len(cred.Groups))
+      for i, g := range cred.Groups {
+        groups[i] = int(g)
+      }
+      if err := syscall.Setgroups(groups); err != nil {
+        return fmt.Errorf("setting groups: %v", err)
+      }
+    }
+    if err := syscall.Setresgid(int(cred.Gid), int(cred.Gid), int(cred.Gid)); err != nil {
+      return fmt.Errorf("setting gid: %v", err)
+    }
+    if err := syscall.Setresuid(int(cred.Uid), int(cred.Uid), int(cred.Uid)); err != nil {
+      return fmt.Errorf("setting uid: %v", err)
+    }
+  }
+  if len(keep) > 0 {
+    if err := raiseAmbient(keep); err != nil {
+      return err
+    }
+  }
+  if spec.NoNewPrivs {
+    if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+      return fmt.Errorf("setting no_new_privs: %v", err)
+    }
+  }
+  return nil
+}
+
+// DropBoundingSet removes every capability from the bounding set of the
+// calling thread, so that neither it nor the children it starts can gain any,
+// not even by running setuid programs or programs with file capabilities. It
+// requires CAP_SETPCAP.
+func DropBoundingSet() error {
+  return dropBoundingSet(nil)
+}
+
+func dropBoundingSet(keep map[int]bool) error {
+  for c := 0; c <= maxCap; c++ {
+    if keep[c] {
+      continue
+    }
+    if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && err != unix.EINVAL {
+      return fmt.Errorf("dropping capability %d: %v", c, err)
+    }
+  }
+  return nil
+}
+
+// raiseAmbient makes the capabilities permitted, inheritable and ambient, so
+// that the command keeps them across execve.
+func raiseAmbient(caps map[int]bool) error {
+  hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+  var data [2]unix.CapUserData
+  for c := range caps {
+    bit := uint32(1) << uint(c%32)
+    data[c/32].Permitted |= bit
+    data[c/32].Effective |= bit
+    data[c/32].Inheritable |= bit
+  }
+  if err := unix.Capset(&hdr, &data[0]); err != nil {
+    return fmt.Errorf("setting capabilities: %v", err)
+  }
+  for c := range caps {
+    if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_RAISE, uintptr(c), 0, 0); err != nil {
+      return fmt.Errorf("raising capability %d: %v", c, err)
+    }
+  }
+  return nil
+}
+
+// dropHelperCaps clears the ambient and inheritable capabilities that were
+// given to the helper, so that the command cannot inherit them.
+func dropHelperCaps() error {
+  if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+    return fmt.Errorf("clearing ambient capabilities: %v", err)
+  }
+  hdr := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+  var data [2]unix.CapUserData
+  if err := unix.Capget(&hdr, &data[0]); err != nil {
+    return fmt.Errorf("getting capabilities: %v", err)
+  }
+  data[0].Inheritable, data[1].Inheritable = 0, 0
+  if err := unix.Capset(&hdr, &data[0]); err != nil {
+    return fmt.Errorf("clearing inheritable capabilities: %v", err)
+  }
+  return nil
+}
+
+func hasNamespace(spec *Spec, name string) bool {
+  for _, ns := range spec.Namespaces {
+    if ns == name {
+      return true
+    }
+  }
+  return false
+}
@@ -0,0 +1,242 @@
+package sandbox
+
+import (
+  "bytes"
+  "encoding/json"
+  "fmt"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "reflect"
+  "strings"
+  "syscall"
+  "testing"
+
+  "golang.org/x/sys/unix"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/limits"
+)
+
+// TestMain lets the test binary act as the sandbox helper. With
+// LISH_SANDBOX_READSPEC set, it prints the Spec it reads instead of running
+// it.
+func TestMain(m *testing.M) {
+  if !IsHelper(os.Args) {
+    os.Exit(m.Run())
+  }
+  if os.Getenv("LISH_SANDBOX_READSPEC") == "" {
+    os.Exit(Init())
+  }
+  spec, err := readSpec()
+  if err != nil {
+    fmt.Println("error:", err)
+    os.Exit(1)
+  }
+  json.NewEncoder(os.Stdout).Encode(spec)
+  os.Exit(0)
+}
+
+func helper(t *testing.T) string {
+  self, err := os.Executable()
+  if err != nil {
+    t.Fatal(err)
+  }
+  return self
+}
+
+func TestSysProcAttr(t *testing.T) {
+  attr := sysProcAttr(&Spec{})
+  if attr.Cloneflags != 0 || attr.Pdeathsig != syscall.SIGKILL {
+    t.Errorf("sysProcAttr without namespaces => %+v, want no clone flags and SIGKILL", attr)
+  }
+
+  attr = sysProcAttr(&Spec{Namespaces: []string{"mount", "pid", "net"}})
+  want := uintptr(syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET)
+  if attr.Cloneflags&^syscall.CLONE_NEWUSER != want {
+    t.Errorf("Cloneflags => %#x, want %#x", attr.Cloneflags&^syscall.CLONE_NEWUSER, want)
+  }
+  attr = sysProcAttr(&Spec{Namespaces: []string{"pid"}})
+  want = uintptr(syscall.CLONE_NEWNS | syscall.CLONE_NEWPID)
+  if attr.Cloneflags&^syscall.CLONE_NEWUSER != want {
+    t.Errorf("Cloneflags for pid => %#x, want %#x with a mount namespace", attr.Cloneflags&^syscall.CLONE_NEWUSER, want)
+  }
+  newUser := attr.Cloneflags&syscall.CLONE_NEWUSER != 0
+  if os.Geteuid() == 0 {
+    if newUser || attr.AmbientCaps != nil {
+      t.Errorf("sysProcAttr for root => %+v, want no user namespace", attr)
+    }
+    return
+  }
+  if !newUser {
+    t.Fatal("sysProcAttr => no user namespace, want one when not root")
+  }
+  uid := []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+  if !reflect.DeepEqual(attr.UidMappings, uid) || attr.GidMappingsEnableSetgroups {
+    t.Errorf("sysProcAttr => %+v, want identity mapping of the uid without setgroups", attr)
+  }
+  if !reflect.DeepEqual(attr.AmbientCaps, []uintptr{unix.CAP_SYS_ADMIN}) {
+    t.Errorf("AmbientCaps => %v, want CAP_SYS_ADMIN", attr.AmbientCaps)
+  }
+}
+
+func TestCheckPeer(t *testing.T) {
+  r, w, err := specChannel()
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer r.Close()
+  defer w.Close()
+  if err := checkPeer(r); err != nil {
+    t.Errorf("checkPeer(socket pair) => %v, want <nil>", err)
+  }
+
+  pr, pw, err := os.Pipe()
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer pr.Close()
+  defer pw.Close()
+  if err := checkPeer(pr); err == nil {
+    t.Error("checkPeer(pipe) => <nil>, want error")
+  }
+}
+
+func TestReadSpec(t *testing.T) {
+  spec := &Spec{
+    Path:       "/bin/true",
+    Argv:       []string{"true", "x"},
+    Env:        []string{"A=b"},
+    Dir:        "/",
+    Namespaces: []string{"uts"},
+    Binds:      []string{"/tmp"},
+    Limits:     limits.Limits{"nofile": 64},
+    Seccomp:    []string{"no-network"},
+    Credential: &Credential{Uid: 1, Gid: 2, Groups: []uint32{3}},
+    Caps:       []string{"net_raw"},
+    NoNewPrivs: true,
+  }
+  c, err := Command(helper(t), spec)
+  if err != nil {
+    t.Fatal(err)
+  }
+  // Only the test binary is run, without namespaces.
+  c.SysProcAttr = nil
+  c.Env = []string{"LISH_SANDBOX_READSPEC=1"}
+  var out bytes.Buffer
+  c.Stdout = &out
+  if err := c.Run(); err != nil {
+    t.Fatalf("Run => %v: %s", err, out.String())
+  }
+  got := &Spec{}
+  if err := json.Unmarshal(out.Bytes(), got); err != nil {
+    t.Fatalf("helper printed %q: %v", out.String(), err)
+  }
+  if !reflect.DeepEqual(got, spec) {
+    t.Errorf("readSpec => %+v, want %+v", got, spec)
+  }
+
+  // A Spec on a pipe may come from anyone.
+  r, w, err := os.Pipe()
+  if err != nil {
+    t.Fatal(err)
+  }
+  cmd := exec.Command(helper(t), Flag)
+  cmd.Env = []string{"LISH_SANDBOX_READSPEC=1"}
+  cmd.ExtraFiles = []*os.File{r}
+  json.NewEncoder(w).Encode(spec)
+  w.Close()
+  output, err := cmd.Output()
+  r.Close()
+  if err == nil || !strings.Contains(string(output), "not handed over by the shell") {
+    t.Errorf("helper with a pipe => (%q, %v), want refusal", output, err)
+  }
+
+  if _, err := Command(helper(t), &Spec{Path: "true", Argv: []string{"true"}}); err == nil {
+    t.Error("Command with a relative path => <nil>, want error")
+  }
+}
+
+// TestNamespaces runs a command in new mount and PID namespaces, with
+// the file system restricted to a single directory.
+func TestNamespaces(t *testing.T) {
+  probe := exec.Command("/bin/true")
+  probe.SysProcAttr = sysProcAttr(&Spec{Namespaces: []string{"mount", "pid"}})
+  if err := probe.Run(); err != nil {
+    t.Skipf("namespaces not available: %v", err)
+  }
+  base, err := ioutil.TempDir("", "lish.sandbox")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(base)
+  bound, hidden := filepath.Join(base, "bound"), filepath.Join(base, "hidden")
+  for _, dir := range []string{bound, hidden} {
+    if err := os.Mkdir(dir, 0755); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  script := fmt.Sprintf("echo $PPID; test -e %s || echo hidden; echo ok >file", hidden)
+  c, err := Command(helper(t), &Spec{
+    Path:       "/bin/sh",
+    Argv:       []string{"sh", "-c", script},
+    Env:        []string{"PATH=/bin:/usr/bin"},
+    Dir:        bound,
+    Namespaces: []string{"mount", "pid"},
+    Binds:      []string{bound},
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  var out, stderr bytes.Buffer
+  c.Stdout, c.Stderr = &out, &stderr
+  if err := c.Run(); err != nil {
+    if strings.Contains(stderr.String(), "permission denied") ||
+      strings.Contains(stderr.String(), "operation not permitted") {
+      t.Skipf("sandbox cannot be set up here: %s", stderr.String())
+    }
+    t.Fatalf("Run => %v: %s", err, stderr.String())
+  }
+  // The init process of the namespace runs the command as its child.
+  if got, want := out.String(), "1\nhidden\n"; got != want {
+    t.Errorf("output => %q, want %q", got, want)
+  }
+  if data, err := ioutil.ReadFile(filepath.Join(bound, "file")); err != nil || string(data) != "ok\n" {
+    t.Errorf("file written in the sandbox => (%q, %v), want ok", data, err)
+  }
+}
+
+// TestPIDNamespaceProc runs a command in a new PID namespace alone, which
+// must not see the processes of the host in /proc.
+func TestPIDNamespaceProc(t *testing.T) {
+  probe := exec.Command("/bin/true")
+  probe.SysProcAttr = sysProcAttr(&Spec{Namespaces: []string{"pid"}})
+  if err := probe.Run(); err != nil {
+    t.Skipf("namespaces not available: %v", err)
+  }
+  // The shell reads /proc/self itself, which is its pid in the namespace
+  // only if /proc belongs to it.
+  c, err := Command(helper(t), &Spec{
+    Path:       "/bin/sh",
+    Argv:       []string{"sh", "-c", "read pid rest </proc/self/stat; echo $$ $pid"},
+    Env:        []string{"PATH=/bin:/usr/bin"},
+    Dir:        "/",
+    Namespaces: []string{"pid"},
+  })
+  if err != nil {
+    t.Fatal(err)
+  }
+  var out, stderr bytes.Buffer
+  c.Stdout, c.Stderr = &out, &stderr
+  if err := c.Run(); err != nil {
+    if strings.Contains(stderr.String(), "permission denied") ||
+      strings.Contains(stderr.String(), "operation not permitted") {
+      t.Skipf("sandbox cannot be set up here: %s", stderr.String())
+    }
+    t.Fatalf("Run => %v: %s", err, stderr.String())
+  }
+  if f := strings.Fields(out.String()); len(f) != 2 || f[0] != f[1] || f[0] == "1" {
+    t.Errorf("pids of the shell => %q, want the same one, other than 1, in /proc", out.String())
+  }
+}
@@ -0,0 +1,38 @@
+//go:build !linux
+// +build !linux
+
+package sandbox
+
+import (
+  "errors"
+  "fmt"
+  "os"
+  "syscall"
+)
+
+const supported = false
+
+func sysProcAttr(spec *Spec) *syscall.SysProcAttr {
+  return nil
+}
+
+// Init is the entry point of the sandbox helper. Sandboxes are only supported
+// on Linux.
+func Init() int {
+  fmt.Fprintln(os.Stderr, "phoenix-shell: sandbox:", errors.New("not supported on this platform"))
+  return 1
+}
+
+// DropBoundingSet removes every capability from the bounding set. There are
+// none outside of Linux.
+func DropBoundingSet() error {
+  return nil
+}
+
+func specChannel() (r, w *os.File, err error) {
+  return nil, nil, errors.New("not supported on this platform")
+}
+
+func checkPeer(f *os.File) error {
+  return errors.New("not supported on this platform")
+}
@@ -0,0 +1,65 @@
+package sandbox
+
+import (
+  "testing"
+
+  "github.com/m9rco/phoenix-shell/src/pkg/limits"
+)
+
+func TestNeedsHelper(t *testing.T) {
+  for _, tt := range []struct {
+    spec Spec
+    want bool
+  }{
+    {Spec{}, false},
+    {Spec{Limits: limits.Limits{limits.Timeout: 10}}, false},
+    {Spec{Namespaces: []string{"net"}}, true},
+    {Spec{Limits: limits.Limits{"nofile": 10}}, true},
+    {Spec{Seccomp: []string{"no-network"}}, true},
+    {Spec{Credential: &Credential{Uid: 1000, Gid: 1000}}, true},
+    {Spec{Caps: []string{"net_raw"}}, true},
+    {Spec{NoNewPrivs: true}, true},
+  } {
+    if got := tt.spec.NeedsHelper(); got != tt.want {
+      t.Errorf("NeedsHelper(%+v) => %v, want %v", tt.spec, got, tt.want)
+    }
+  }
+}
+
+func TestValidate(t *testing.T) {
+  valid := Spec{Path: "/bin/true", Argv: []string{"true"}, Dir: "/"}
+  if err := valid.validate(); err != nil {
+    t.Errorf("validate(%+v) => %v, want <nil>", valid, err)
+  }
+  for _, change := range []func(spec *Spec){
+    func(spec *Spec) { spec.Path = "" },
+    func(spec *Spec) { spec.Path = "true" },
+    func(spec *Spec) { spec.Argv = nil },
+    func(spec *Spec) { spec.Dir = "tmp" },
+    func(spec *Spec) { spec.Namespaces = []string{"user"} },
+    func(spec *Spec) { spec.Binds = []string{"home"} },
+    func(spec *Spec) { spec.Caps = []string{"no_such_cap"} },
+  } {
+    spec := valid
+    change(&spec)
+    if err := spec.validate(); err == nil {
+      t.Errorf("validate(%+v) => <nil>, want error", spec)
+    }
+  }
+}
+
+func TestIsHelper(t *testing.T) {
+  for _, tt := range []struct {
+    args []string
+    want bool
+  }{
+    {[]string{"lish", Flag}, true},
+    {[]string{"lish"}, false},
+    {[]string{"lish", Flag, "x"}, false},
+    {[]string{"lish", "-log", "x", Flag}, false},
+  } {
+    if got := IsHelper(tt.args); got != tt.want {
+      t.Errorf("IsHelper(%q) => %v, want %v", tt.args, got, tt.want)
+    }
+  }
+}
@@ -0,0 +1,72 @@
+//go:build linux && amd64
+// +build linux,amd64
+
+package seccomp
+
+import (
+  "golang.org/x/sys/unix"
+)
+
+// auditArch is AUDIT_ARCH_X86_64.
+const auditArch = 0xc000003e
+
+// x32Bit marks the system calls of the x32 ABI.
+const x32Bit = 0x40000000
+
+// syscalls maps the names of the system calls used in profiles to their
+// numbers.
+var syscalls = map[string]int{
+  "socket":          unix.SYS_SOCKET,
+  "io_uring_setup":  unix.SYS_IO_URING_SETUP,
+  "write":           unix.SYS_WRITE,
+  "writev":          unix.SYS_WRITEV,
+  "pwrite64":        unix.SYS_PWRITE64,
+  "pwritev":         unix.SYS_PWRITEV,
+  "pwritev2":        unix.SYS_PWRITEV2,
+  "sendfile":        unix.SYS_SENDFILE,
+  "vmsplice":        unix.SYS_VMSPLICE,
+  "tee":             unix.SYS_TEE,
+  "splice":          unix.SYS_SPLICE,
+  "copy_file_range": unix.SYS_COPY_FILE_RANGE,
+  "open":            unix.SYS_OPEN,
+  "openat":          unix.SYS_OPENAT,
+  "creat":           unix.SYS_CREAT,
+  "truncate":        unix.SYS_TRUNCATE,
+  "ftruncate":       unix.SYS_FTRUNCATE,
+  "fallocate":       unix.SYS_FALLOCATE,
+  "unlink":          unix.SYS_UNLINK,
+  "unlinkat":        unix.SYS_UNLINKAT,
+  "rename":          unix.SYS_RENAME,
+  "renameat":        unix.SYS_RENAMEAT,
+  "renameat2":       unix.SYS_RENAMEAT2,
+  "mkdir":           unix.SYS_MKDIR,
+  "mkdirat":         unix.SYS_MKDIRAT,
+  "rmdir":           unix.SYS_RMDIR,
+  "link":            unix.SYS_LINK,
+  "linkat":          unix.SYS_LINKAT,
+  "symlink":         unix.SYS_SYMLINK,
+  "symlinkat":       unix.SYS_SYMLINKAT,
+  "mknod":           unix.SYS_MKNOD,
+  "mknodat":         unix.SYS_MKNODAT,
+  "chmod":           unix.SYS_CHMOD,
+  "fchmod":          unix.SYS_FCHMOD,
+  "fchmodat":        unix.SYS_FCHMODAT,
+  "chown":           unix.SYS_CHOWN,
+  "fchown":          unix.SYS_FCHOWN,
+  "fchownat":        unix.SYS_FCHOWNAT,
+  "lchown":          unix.SYS_LCHOWN,
+  "utime":           unix.SYS_UTIME,
+  "utimes":          unix.SYS_UTIMES,
+  "utimensat":       unix.SYS_UTIMENSAT,
+  "futimesat":       unix.SYS_FUTIMESAT,
+  "setxattr":        unix.SYS_SETXATTR,
+  "lsetxattr":       unix.SYS_LSETXATTR,
+  "fsetxattr":       unix.SYS_FSETXATTR,
+  "removexattr":     unix.SYS_REMOVEXATTR,
+  "lremovexattr":    unix.SYS_LREMOVEXATTR,
+  "fremovexattr":    unix.SYS_FREMOVEXATTR,
+  "execve":          unix.SYS_EXECVE,
+  "execveat":        unix.SYS_EXECVEAT,
+  "openat2":         437,
+  "fchmodat2":       452,
+}
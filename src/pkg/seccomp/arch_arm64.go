@@ -0,0 +1,57 @@
+//go:build linux && arm64
+// +build linux,arm64
+
+package seccomp
+
+import (
+  "golang.org/x/sys/unix"
+)
+
+// auditArch is AUDIT_ARCH_AARCH64.
+const auditArch = 0xc00000b7
+
+// x32Bit is not used on this architecture.
+const x32Bit = 0
+
+// syscalls maps the names of the system calls used in profiles to their
+// numbers.
+var syscalls = map[string]int{
+  "socket":          unix.SYS_SOCKET,
+  "io_uring_setup":  unix.SYS_IO_URING_SETUP,
+  "write":           unix.SYS_WRITE,
+  "writev":          unix.SYS_WRITEV,
+  "pwrite64":        unix.SYS_PWRITE64,
+  "pwritev":         unix.SYS_PWRITEV,
+  "pwritev2":        unix.SYS_PWRITEV2,
+  "sendfile":        unix.SYS_SENDFILE,
+  "vmsplice":        unix.SYS_VMSPLICE,
+  "tee":             unix.SYS_TEE,
+  "splice":          unix.SYS_SPLICE,
+  "copy_file_range": unix.SYS_COPY_FILE_RANGE,
+  "openat":          unix.SYS_OPENAT,
+  "truncate":        unix.SYS_TRUNCATE,
+  "ftruncate":       unix.SYS_FTRUNCATE,
+  "fallocate":       unix.SYS_FALLOCATE,
+  "unlinkat":        unix.SYS_UNLINKAT,
+  "renameat":        unix.SYS_RENAMEAT,
+  "renameat2":       unix.SYS_RENAMEAT2,
+  "mkdirat":         unix.SYS_MKDIRAT,
+  "linkat":          unix.SYS_LINKAT,
+  "symlinkat":       unix.SYS_SYMLINKAT,
+  "mknodat":         unix.SYS_MKNODAT,
+  "fchmod":          unix.SYS_FCHMOD,
+  "fchmodat":        unix.SYS_FCHMODAT,
+  "fchown":          unix.SYS_FCHOWN,
+  "fchownat":        unix.SYS_FCHOWNAT,
+  "utimensat":       unix.SYS_UTIMENSAT,
+  "setxattr":        unix.SYS_SETXATTR,
+  "lsetxattr":       unix.SYS_LSETXATTR,
+  "fsetxattr":       unix.SYS_FSETXATTR,
+  "removexattr":     unix.SYS_REMOVEXATTR,
+  "lremovexattr":    unix.SYS_LREMOVEXATTR,
+  "fremovexattr":    unix.SYS_FREMOVEXATTR,
+  "execve":          unix.SYS_EXECVE,
+  "execveat":        unix.SYS_EXECVEAT,
+  "openat2":         437,
+  "fchmodat2":       452,
+}
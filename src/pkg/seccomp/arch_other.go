@@ -0,0 +1,12 @@
+//go:build linux && !amd64 && !arm64
+// +build linux,!amd64,!arm64
+
+package seccomp
+
+// Seccomp filters are not supported on this architecture.
+const (
+  auditArch = 0
+  x32Bit    = 0
+)
+
+var syscalls = map[string]int{}
@@ -0,0 +1,106 @@
+// Package seccomp restricts the system calls of commands with named profiles
+// of seccomp filters.
+package seccomp
+
+import (
+  "sort"
+  "syscall"
+)
+
+// Profiles maps the names of the profiles to the denials they consist of:
+//
+//	no-network  sockets can only be created for local communication
+//	            (AF_UNIX), so that neither connect nor any other call
+//	            reaches the network; io_uring is unavailable
+//	read-only   writing is only possible to the standard file descriptors,
+//	            which the shell connects to the terminal; files cannot be
+//	            opened for writing, created, removed, renamed or have their
+//	            attributes changed
+//	no-exec     the command cannot execute any other program, which keeps
+//	            programs such as less or vi from starting a shell; see
+//	            NotExecPath for the limits of this
+var Profiles = map[string][]Denial{
+  "no-network": {
+    {Syscalls: []string{"socket"}, Check: Check{Op: NotEqual, Arg: 0, Value: syscall.AF_UNIX}, Errno: syscall.EACCES},
+    {Syscalls: []string{"io_uring_setup"}, Errno: syscall.ENOSYS},
+  },
+  "read-only": {
+    {Syscalls: []string{"write", "writev", "pwrite64", "pwritev", "pwritev2", "sendfile", "vmsplice"},
+      Check: Check{Op: AtLeast, Arg: 0, Value: 3}, Errno: syscall.EBADF},
+    {Syscalls: []string{"tee"}, Check: Check{Op: AtLeast, Arg: 1, Value: 3}, Errno: syscall.EBADF},
+    {Syscalls: []string{"splice", "copy_file_range"}, Check: Check{Op: AtLeast, Arg: 2, Value: 3}, Errno: syscall.EBADF},
+    {Syscalls: []string{"open"}, Check: Check{Op: AnyBit, Arg: 1, Value: openWriteFlags}, Errno: syscall.EROFS},
+    {Syscalls: []string{"openat"}, Check: Check{Op: AnyBit, Arg: 2, Value: openWriteFlags}, Errno: syscall.EROFS},
+    // The flags of openat2 cannot be inspected; C libraries fall back to
+    // openat.
+    {Syscalls: []string{"openat2", "io_uring_setup"}, Errno: syscall.ENOSYS},
+    {Syscalls: []string{
+      "creat", "truncate", "ftruncate", "fallocate",
+      "unlink", "unlinkat", "rename", "renameat", "renameat2",
+      "mkdir", "mkdirat", "rmdir", "link", "linkat", "symlink", "symlinkat",
+      "mknod", "mknodat", "chmod", "fchmod", "fchmodat", "fchmodat2",
+      "chown", "fchown", "fchownat", "lchown",
+      "utime", "utimes", "utimensat", "futimesat",
+      "setxattr", "lsetxattr", "fsetxattr", "removexattr", "lremovexattr", "fremovexattr",
+    }, Errno: syscall.EROFS},
+  },
+  NoExec: {
+    {Syscalls: []string{"execve"}, Check: Check{Op: NotExecPath}, Errno: syscall.EPERM},
+    {Syscalls: []string{"execveat"}, Errno: syscall.EPERM},
+  },
+}
+
+// NoExec is the name of the profile denying the execution of programs.
+const NoExec = "no-exec"
+
+const openWriteFlags = syscall.O_WRONLY | syscall.O_RDWR | syscall.O_CREAT | syscall.O_TRUNC | syscall.O_APPEND
+
+// Op is a comparison of a system call argument.
+type Op int
+
+const (
+  // Always matches without looking at the argument.
+  Always Op = iota
+  // AtLeast matches arguments of at least Value, as 32-bit integers, such
+  // as file descriptors.
+  AtLeast
+  // AnyBit matches 32-bit arguments with any of the bits of Value set.
+  AnyBit
+  // NotEqual matches 32-bit arguments other than Value.
+  NotEqual
+  // NotEqual64 matches 64-bit arguments other than Value, such as
+  // pointers.
+  NotEqual64
+  // NotExecPath matches arguments other than the address of the path given
+  // to Exec, which is then the only one execve accepts. Filters cannot
+  // inspect the string itself, so a program able to place another path at
+  // the very same address could still execute it, but programs do not
+  // happen to do so when running a shell.
+  NotExecPath
+)
+
+// Check restricts a denial to the calls whose argument Arg, counted from 0,
+// matches.
+type Check struct {
+  Op    Op
+  Arg   int
+  Value uint64
+}
+
+// Denial makes the named system calls fail with Errno if Check matches.
+// System calls that do not exist on an architecture are ignored.
+type Denial struct {
+  Syscalls []string
+  Check    Check
+  Errno    syscall.Errno
+}
+
+// Names returns the names of the profiles in order.
+func Names() []string {
+  var names []string
+  for name := range Profiles {
+    names = append(names, name)
+  }
+  sort.Strings(names)
+  return names
+}
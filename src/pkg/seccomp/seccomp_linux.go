@@ -0,0 +1,190 @@
+package seccomp
+
+import (
+  "errors"
+  "fmt"
+  "runtime"
+  "syscall"
+  "unsafe"
+
+  "golang.org/x/sys/unix"
+)
+
+// Return values of filters and the layout of struct seccomp_data, which are
+// missing from x/sys.
+const (
+  retAllow = 0x7fff0000
+  retErrno = 0x00050000
+  retKill  = 0x80000000
+
+  offsetNr   = 0
+  offsetArch = 4
+  offsetArgs = 16
+)
+
+// label is the target of a jump within a block of the filter.
+type label int
+
+const (
+  next label = iota // the following instruction
+  deny              // the return of the errno of the block
+  skip              // the next block
+)
+
+type insn struct {
+  code   uint16
+  jt, jf label
+  k      uint32
+}
+
+// Exec installs a filter made of the denials of the named profiles for the
+// calling thread and executes the program at path with it, which then keeps
+// the filter. It sets no_new_privs, as is required to install filters
+// unprivileged. The caller must be locked to its thread.
+func Exec(profiles []string, path string, argv, env []string) error {
+  if len(profiles) == 0 {
+    return syscall.Exec(path, argv, env)
+  }
+  pathp, err := syscall.BytePtrFromString(path)
+  if err != nil {
+    return err
+  }
+  argvp, err := syscall.SlicePtrFromStrings(argv)
+  if err != nil {
+    return err
+  }
+  envp, err := syscall.SlicePtrFromStrings(env)
+  if err != nil {
+    return err
+  }
+  if err := install(profiles, uintptr(unsafe.Pointer(pathp))); err != nil {
+    return err
+  }
+  _, _, errno := syscall.RawSyscall(unix.SYS_EXECVE,
+    uintptr(unsafe.Pointer(pathp)), uintptr(unsafe.Pointer(&argvp[0])), uintptr(unsafe.Pointer(&envp[0])))
+  runtime.KeepAlive(pathp)
+  runtime.KeepAlive(argvp)
+  runtime.KeepAlive(envp)
+  return errno
+}
+
+// install installs the filter of the named profiles, where execPath is the
+// address of the path of the program about to be executed.
+func install(profiles []string, execPath uintptr) error {
+  if len(profiles) == 0 {
+    return nil
+  }
+  filter, err := compileProfiles(profiles, execPath)
+  if err != nil {
+    return err
+  }
+  if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+    return fmt.Errorf("setting no_new_privs: %v", err)
+  }
+  prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+  if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+    return fmt.Errorf("installing seccomp filter: %v", err)
+  }
+  return nil
+}
+
+// Compile translates the denials of the named profiles into a BPF program,
+// to check that they are supported.
+func Compile(profiles []string) ([]unix.SockFilter, error) {
+  return compileProfiles(profiles, 0)
+}
+
+func compileProfiles(profiles []string, execPath uintptr) ([]unix.SockFilter, error) {
+  var denials []Denial
+  for _, name := range profiles {
+    p, ok := Profiles[name]
+    if !ok {
+      return nil, fmt.Errorf("unknown seccomp profile %q", name)
+    }
+    for _, d := range p {
+      if d.Check.Op == NotExecPath {
+        d.Check = Check{Op: NotEqual64, Arg: d.Check.Arg, Value: uint64(execPath)}
+      }
+      denials = append(denials, d)
+    }
+  }
+  return compile(denials)
+}
+
+func compile(denials []Denial) ([]unix.SockFilter, error) {
+  if auditArch == 0 {
+    return nil, errors.New("seccomp filters are not supported on this architecture")
+  }
+  filter := []unix.SockFilter{
+    stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetArch),
+    jump(unix.BPF_JEQ, auditArch, 1, 0),
+    stmt(unix.BPF_RET|unix.BPF_K, retKill),
+    stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, offsetNr),
+  }
+  if x32Bit != 0 {
+    // System calls of another ABI sharing the architecture.
+    filter = append(filter,
+      jump(unix.BPF_JGE, x32Bit, 0, 1),
+      stmt(unix.BPF_RET|unix.BPF_K, retKill))
+  }
+  for _, d := range denials {
+    for _, name := range d.Syscalls {
+      nr, ok := syscalls[name]
+      if !ok {
+        continue
+      }
+      filter = append(filter, block(nr, d.Check, d.Errno)...)
+    }
+  }
+  return append(filter, stmt(unix.BPF_RET|unix.BPF_K, retAllow)), nil
+}
+
+// block returns the instructions denying the system call nr if check
+// matches. It expects the system call number in the accumulator and leaves it
+// there for the next block.
+func block(nr int, check Check, errno syscall.Errno) []unix.SockFilter {
+  insns := []insn{{code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, k: uint32(nr), jt: next, jf: skip}}
+  low := uint32(offsetArgs + 8*check.Arg)
+  load := func(offset uint32) insn {
+    return insn{code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, k: offset}
+  }
+  switch check.Op {
+  case AtLeast:
+    insns = append(insns, load(low), insn{code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, k: uint32(check.Value), jt: deny, jf: skip})
+  case AnyBit:
+    insns = append(insns, load(low), insn{code: unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K, k: uint32(check.Value), jt: deny, jf: skip})
+  case NotEqual:
+    insns = append(insns, load(low), insn{code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, k: uint32(check.Value), jt: skip, jf: deny})
+  case NotEqual64:
+    insns = append(insns,
+      load(low), insn{code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, k: uint32(check.Value), jt: next, jf: deny},
+      load(low+4), insn{code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, k: uint32(check.Value >> 32), jt: skip, jf: deny})
+  }
+  insns = append(insns, insn{code: unix.BPF_RET | unix.BPF_K, k: retErrno | uint32(errno)})
+  // The next block starts by loading the system call number again.
+  insns = append(insns, load(offsetNr))
+
+  denyAt, skipAt := len(insns)-2, len(insns)-1
+  resolve := func(at int, l label) uint8 {
+    switch l {
+    case deny:
+      return uint8(denyAt - at - 1)
+    case skip:
+      return uint8(skipAt - at - 1)
+    }
+    return 0
+  }
+  filter := make([]unix.SockFilter, len(insns))
+  for i, in := range insns {
+    filter[i] = unix.SockFilter{Code: in.code, Jt: resolve(i, in.jt), Jf: resolve(i, in.jf), K: in.k}
+  }
+  return filter
+}
+
+func stmt(code uint16, k uint32) unix.SockFilter {
+  return unix.SockFilter{Code: code, K: k}
+}
+
+func jump(op uint16, k uint32, jt, jf uint8) unix.SockFilter {
+  return unix.SockFilter{Code: unix.BPF_JMP | op | unix.BPF_K, K: k, Jt: jt, Jf: jf}
+}
@@ -0,0 +1,195 @@
+package seccomp
+
+import (
+  "fmt"
+  "io/ioutil"
+  "os"
+  "os/exec"
+  "path/filepath"
+  "runtime"
+  "strings"
+  "syscall"
+  "testing"
+  "unsafe"
+)
+
+// probes are run in order by the helper process with the profile installed.
+// Each returns the error of a system call. Probes removing the file come last,
+// as the others need it.
+var probes = []struct {
+  name string
+  run  func(dir string) error
+}{
+  {"inet socket", func(string) error {
+    fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+    syscall.Close(fd)
+    return err
+  }},
+  {"unix socket", func(string) error {
+    fd, err := syscall.Socket(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+    syscall.Close(fd)
+    return err
+  }},
+  {"open for reading", func(dir string) error {
+    fd, err := syscall.Open(filepath.Join(dir, "file"), syscall.O_RDONLY, 0)
+    syscall.Close(fd)
+    return err
+  }},
+  {"open for writing", func(dir string) error {
+    fd, err := syscall.Open(filepath.Join(dir, "file"), syscall.O_WRONLY, 0)
+    syscall.Close(fd)
+    return err
+  }},
+  {"write to pipe", func(string) error {
+    var p [2]int
+    if err := syscall.Pipe(p[:]); err != nil {
+      return err
+    }
+    defer syscall.Close(p[0])
+    defer syscall.Close(p[1])
+    _, err := syscall.Write(p[1], []byte("x"))
+    return err
+  }},
+  {"write to stderr", func(string) error {
+    _, err := syscall.Write(2, nil)
+    return err
+  }},
+  // fchmodat2 is not in the syscall package; its number is that of amd64
+  // and arm64, the architectures filters support.
+  {"fchmodat2", func(dir string) error {
+    path, err := syscall.BytePtrFromString(filepath.Join(dir, "file"))
+    if err != nil {
+      return err
+    }
+    cwd := -100 // AT_FDCWD
+    _, _, errno := syscall.Syscall6(452, uintptr(cwd), uintptr(unsafe.Pointer(path)), 0600, 0, 0, 0)
+    if errno != 0 {
+      return errno
+    }
+    return nil
+  }},
+  {"unlink", func(dir string) error {
+    return syscall.Unlink(filepath.Join(dir, "file"))
+  }},
+}
+
+var want = map[string]map[string]error{
+  "no-network": {
+    "inet socket": syscall.EACCES, "unix socket": nil,
+    "open for writing": nil, "write to pipe": nil,
+  },
+  "read-only": {
+    "inet socket": nil, "open for reading": nil, "open for writing": syscall.EROFS,
+    "write to pipe": syscall.EBADF, "write to stderr": nil, "unlink": syscall.EROFS,
+    "fchmodat2": syscall.EROFS,
+  },
+}
+
+func TestProfiles(t *testing.T) {
+  if _, err := Compile([]string{"no-network"}); err != nil {
+    t.Skip(err)
+  }
+  for profile, probeWant := range want {
+    dir, err := ioutil.TempDir("", "lish.seccomp")
+    if err != nil {
+      t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    if err := ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+      t.Fatal(err)
+    }
+    c := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+    c.Env = append(os.Environ(), "LISH_SECCOMP_PROFILE="+profile, "LISH_SECCOMP_DIR="+dir)
+    out, err := c.Output()
+    if err != nil {
+      t.Fatalf("%s: helper process => %v", profile, err)
+    }
+    results := map[string]string{}
+    for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+      if i := strings.IndexByte(line, '='); i >= 0 {
+        results[line[:i]] = line[i+1:]
+      }
+    }
+    for probe, err := range probeWant {
+      if got := results[probe]; got != fmt.Sprint(err) {
+        t.Errorf("%s: %s => %s, want %v", profile, probe, got, err)
+      }
+    }
+  }
+}
+
+func TestHelperProcess(t *testing.T) {
+  // The filter only applies to the thread installing it.
+  runtime.LockOSThread()
+  if os.Getenv("LISH_SECCOMP_EXEC") != "" {
+    err := Exec([]string{NoExec}, "/bin/sh", []string{"sh", "-c", "/bin/true 2>/dev/null; echo $?"}, nil)
+    fmt.Println("exec:", err)
+    os.Exit(1)
+  }
+  profile := os.Getenv("LISH_SECCOMP_PROFILE")
+  if profile == "" {
+    return
+  }
+  if err := install([]string{profile}, 0); err != nil {
+    fmt.Println("install:", err)
+    os.Exit(1)
+  }
+  var out []string
+  for _, probe := range probes {
+    out = append(out, fmt.Sprintf("%s=%v", probe.name, probe.run(os.Getenv("LISH_SECCOMP_DIR"))))
+  }
+  // Write through the standard output, which the profiles allow.
+  syscall.Write(1, []byte(strings.Join(out, "\n")+"\n"))
+  os.Exit(0)
+}
+
+func TestNoExec(t *testing.T) {
+  if _, err := Compile([]string{NoExec}); err != nil {
+    t.Skip(err)
+  }
+  c := exec.Command(os.Args[0], "-test.run=TestHelperProcess")
+  c.Env = append(os.Environ(), "LISH_SECCOMP_EXEC=1")
+  out, err := c.Output()
+  // The shell itself is executed, but cannot execute anything else.
+  if err != nil || strings.TrimSpace(string(out)) != "126" {
+    t.Errorf("sh -c '/bin/true; echo $?' with %s => (%q, %v), want 126", NoExec, out, err)
+  }
+}
+
+// atOnly lists the system calls of profiles that architectures such as arm64
+// lack, having only the variants taking a directory file descriptor.
+var atOnly = []string{
+  "open", "creat", "unlink", "rename", "mkdir", "rmdir", "link", "symlink", "mknod",
+  "chmod", "chown", "lchown", "utime", "utimes", "futimesat",
+}
+
+func TestSyscallNumbers(t *testing.T) {
+  if len(syscalls) == 0 {
+    t.Skip("seccomp filters are not supported on " + runtime.GOARCH)
+  }
+  for profile, denials := range Profiles {
+    for _, d := range denials {
+      for _, name := range d.Syscalls {
+        if _, ok := syscalls[name]; ok || runtime.GOARCH != "amd64" && contains(atOnly, name) {
+          continue
+        }
+        t.Errorf("%s: no number for %s on %s, so it is not denied", profile, name, runtime.GOARCH)
+      }
+    }
+  }
+}
+
+func TestUnknownProfile(t *testing.T) {
+  if _, err := Compile([]string{"no-such-profile"}); err == nil {
+    t.Error("Compile with unknown profile => <nil>, want error")
+  }
+}
+
+func contains(list []string, s string) bool {
+  for _, x := range list {
+    if x == s {
+      return true
+    }
+  }
+  return false
+}
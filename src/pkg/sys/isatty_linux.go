@@ -0,0 +1,14 @@
+package sys
+
+import (
+  "golang.org/x/sys/unix"
+  "os"
+  "unsafe"
+)
+
+// IsATTY returns true if the given file is a terminal.
+func IsATTY(file *os.File) bool {
+  var term unix.Termios
+  err := Ioctl(int(file.Fd()), unix.TCGETS, uintptr(unsafe.Pointer(&term)))
+  return err == nil
+}
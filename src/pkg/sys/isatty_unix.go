@@ -1,3 +1,5 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+
 package sys
 
 import (
@@ -0,0 +1,21 @@
+package sys
+
+import (
+  "syscall"
+)
+
+// SwitchUser sets the user and group IDs to the given ones, which must be the
+// real ones unless we run as root, so that a setuid or setgid process, or one
+// started by root, cannot regain its privileges. The supplementary groups are
+// left alone if groups is nil.
+func SwitchUser(uid, gid int, groups []int) error {
+  if groups != nil {
+    if err := syscall.Setgroups(groups); err != nil {
+      return err
+    }
+  }
+  if err := syscall.Setgid(gid); err != nil {
+    return err
+  }
+  return syscall.Setuid(uid)
+}
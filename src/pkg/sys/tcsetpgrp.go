@@ -0,0 +1,12 @@
+package sys
+
+import (
+  "golang.org/x/sys/unix"
+  "unsafe"
+)
+
+// Tcsetpgrp makes pgid the foreground process group of the terminal fd.
+func Tcsetpgrp(fd int, pgid int) error {
+  i := int32(pgid)
+  return Ioctl(fd, unix.TIOCSPGRP, uintptr(unsafe.Pointer(&i)))
+}
@@ -0,0 +1,22 @@
+// Package watch notices changes to files, such as the configuration files of
+// a running session.
+package watch
+
+// Watcher calls a function whenever one of a set of files is created,
+// written, replaced or removed. Files are watched through their directories,
+// so that files replaced by renaming, as editors do, or created later are
+// noticed as well, and so are the targets of symbolic links. Files in
+// directories that do not exist when the watcher is created are not watched.
+type Watcher struct {
+  impl
+}
+
+// New watches the given files, calling changed with the path of any file that
+// changes, from another goroutine.
+func New(paths []string, changed func(path string)) (*Watcher, error) {
+  w := &Watcher{}
+  if err := w.start(paths, changed); err != nil {
+    return nil, err
+  }
+  return w, nil
+}
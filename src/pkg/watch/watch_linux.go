@@ -0,0 +1,96 @@
+package watch
+
+import (
+  "os"
+  "path/filepath"
+  "unsafe"
+
+  "golang.org/x/sys/unix"
+)
+
+// events are the inotify events of a directory that may change the files in
+// it.
+const events = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+type impl struct {
+  file *os.File
+}
+
+func (w *impl) start(paths []string, changed func(path string)) error {
+  fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+  if err != nil {
+    return os.NewSyscallError("inotify_init1", err)
+  }
+  // Reads of a non-blocking file go through the poller, so that Close stops
+  // them.
+  w.file = os.NewFile(uintptr(fd), "inotify")
+  files := map[string]bool{}
+  dirs := map[int]string{}
+  var all []string
+  for _, path := range paths {
+    all = append(all, path)
+    if target, err := filepath.EvalSymlinks(path); err == nil && target != path {
+      all = append(all, target)
+    } else if target, err := os.Readlink(path); err == nil {
+      // A link to a file yet to be created.
+      if !filepath.IsAbs(target) {
+        target = filepath.Join(filepath.Dir(path), target)
+      }
+      all = append(all, target)
+    }
+  }
+  for _, path := range all {
+    path = filepath.Clean(path)
+    files[path] = true
+    dir := filepath.Dir(path)
+    wd, err := unix.InotifyAddWatch(fd, dir, events)
+    if err == unix.ENOENT || err == unix.ENOTDIR {
+      continue
+    } else if err != nil {
+      w.file.Close()
+      return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+    }
+    dirs[wd] = dir
+  }
+  go w.read(files, dirs, changed)
+  return nil
+}
+
+func (w *impl) read(files map[string]bool, dirs map[int]string, changed func(path string)) {
+  buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+  for {
+    n, err := w.file.Read(buf)
+    if err != nil {
+      // Closed.
+      return
+    }
+    for off := 0; off+unix.SizeofInotifyEvent <= n; {
+      event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+      name := buf[off+unix.SizeofInotifyEvent : off+unix.SizeofInotifyEvent+int(event.Len)]
+      off += unix.SizeofInotifyEvent + int(event.Len)
+      dir, ok := dirs[int(event.Wd)]
+      if !ok {
+        continue
+      }
+      path := filepath.Join(dir, string(trimNUL(name)))
+      if files[path] {
+        changed(path)
+      }
+    }
+  }
+}
+
+// Close stops watching.
+func (w *impl) Close() error {
+  return w.file.Close()
+}
+
+// trimNUL removes the padding of names in inotify events.
+func trimNUL(name []byte) []byte {
+  for i, b := range name {
+    if b == 0 {
+      return name[:i]
+    }
+  }
+  return name
+}
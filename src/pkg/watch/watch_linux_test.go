@@ -0,0 +1,51 @@
+package watch
+
+import (
+  "io/ioutil"
+  "os"
+  "path/filepath"
+  "testing"
+  "time"
+)
+
+func TestWatch(t *testing.T) {
+  dir, err := ioutil.TempDir("", "lish")
+  if err != nil {
+    t.Fatal(err)
+  }
+  defer os.RemoveAll(dir)
+  file := filepath.Join(dir, "lishrc")
+  link := filepath.Join(dir, "link")
+  target := filepath.Join(dir, "target")
+  if err := os.Symlink(target, link); err != nil {
+    t.Fatal(err)
+  }
+  changes := make(chan string, 16)
+  w, err := New([]string{file, link, filepath.Join(dir, "missing", "x")}, func(path string) {
+    changes <- path
+  })
+  if err != nil {
+    t.Fatalf("New => %v, want <nil>", err)
+  }
+  defer w.Close()
+
+  // Unrelated files are ignored.
+  for _, path := range []string{filepath.Join(dir, "other"), file, target} {
+    if err := ioutil.WriteFile(path, []byte("x\n"), 0644); err != nil {
+      t.Fatal(err)
+    }
+  }
+  seen := map[string]bool{}
+  timeout := time.After(5 * time.Second)
+  for !seen[file] || !seen[target] {
+    select {
+    case path := <-changes:
+      if path != file && path != target {
+        t.Errorf("changed(%q), want %s or %s", path, file, target)
+      }
+      seen[path] = true
+    case <-timeout:
+      t.Fatalf("changes noticed: %v, want %s and %s", seen, file, target)
+    }
+  }
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+// +build !linux
+
+package watch
+
+import (
+  "errors"
+)
+
+type impl struct{}
+
+func (w *impl) start(paths []string, changed func(path string)) error {
+  return errors.New("watching files is not supported on this platform")
+}
+
+// Close stops watching.
+func (w *impl) Close() error { return nil }